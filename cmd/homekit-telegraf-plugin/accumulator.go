@@ -0,0 +1,58 @@
+package main
+
+import (
+	"time"
+
+	"github.com/influxdata/telegraf"
+	"github.com/influxdata/telegraf/metric"
+)
+
+// metricCollector is a minimal telegraf.Accumulator collecting the added metrics
+// (used by the commands running the plugin's decoding pipeline without Telegraf).
+type metricCollector struct {
+	metrics []telegraf.Metric
+	errors  []error
+}
+
+func (collector *metricCollector) AddFields(measurement string, fields map[string]interface{}, tags map[string]string, t ...time.Time) {
+	collector.add(measurement, fields, tags, telegraf.Untyped, t...)
+}
+
+func (collector *metricCollector) AddGauge(measurement string, fields map[string]interface{}, tags map[string]string, t ...time.Time) {
+	collector.add(measurement, fields, tags, telegraf.Gauge, t...)
+}
+
+func (collector *metricCollector) AddCounter(measurement string, fields map[string]interface{}, tags map[string]string, t ...time.Time) {
+	collector.add(measurement, fields, tags, telegraf.Counter, t...)
+}
+
+func (collector *metricCollector) AddSummary(measurement string, fields map[string]interface{}, tags map[string]string, t ...time.Time) {
+	collector.add(measurement, fields, tags, telegraf.Summary, t...)
+}
+
+func (collector *metricCollector) AddHistogram(measurement string, fields map[string]interface{}, tags map[string]string, t ...time.Time) {
+	collector.add(measurement, fields, tags, telegraf.Histogram, t...)
+}
+
+func (collector *metricCollector) AddMetric(m telegraf.Metric) {
+	collector.metrics = append(collector.metrics, m)
+}
+
+func (collector *metricCollector) SetPrecision(precision time.Duration) {
+}
+
+func (collector *metricCollector) AddError(err error) {
+	collector.errors = append(collector.errors, err)
+}
+
+func (collector *metricCollector) WithTracking(maxTracked int) telegraf.TrackingAccumulator {
+	return nil
+}
+
+func (collector *metricCollector) add(measurement string, fields map[string]interface{}, tags map[string]string, valueType telegraf.ValueType, t ...time.Time) {
+	tm := time.Now()
+	if len(t) > 0 {
+		tm = t[0]
+	}
+	collector.metrics = append(collector.metrics, metric.New(measurement, tags, fields, tm, valueType))
+}
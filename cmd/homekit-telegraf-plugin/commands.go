@@ -0,0 +1,362 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/brutella/hap"
+	"github.com/hdecarne-github/homekit-telegraf-plugin/plugins/inputs/homekit"
+	"github.com/influxdata/telegraf/plugins/serializers/influx"
+)
+
+type command struct {
+	usage string
+	run   func(args []string) error
+}
+
+var commands = map[string]command{
+	"info":     {usage: "info [-config <file>]", run: runInfo},
+	"pairings": {usage: "pairings [-config <file>] list|remove <name>", run: runPairings},
+	"reset":    {usage: "reset [-config <file>] [-force]", run: runReset},
+	"test":     {usage: "test [-config <file>] -payload <file> [-content-type <type>]", run: runTest},
+	"replay":   {usage: "replay [-config <file>] [-timestamps original|now] <record file>...", run: runReplay},
+	"discover": {usage: "discover [-timeout <duration>]", run: runDiscover},
+	"export":   {usage: "export [-config <file>] [-file <archive>] [-passphrase-file <file>]", run: runExport},
+	"import":   {usage: "import [-config <file>] [-file <archive>] [-passphrase-file <file>] [-force]", run: runImport},
+}
+
+var errUsage = errors.New("invalid command arguments")
+
+func runCommand(name string, args []string) int {
+	cmd := commands[name]
+	err := cmd.run(args)
+	if errors.Is(err, errUsage) {
+		fmt.Fprintf(os.Stderr, "Usage: %s %s\n", os.Args[0], cmd.usage)
+		return 2
+	} else if err != nil {
+		fmt.Fprintf(os.Stderr, "Err: %s\n", err)
+		return 1
+	}
+	return 0
+}
+
+func newCommandFlags(name string) (*flag.FlagSet, *string) {
+	flags := flag.NewFlagSet(name, flag.ContinueOnError)
+	flags.SetOutput(io.Discard)
+	configFile := flags.String("config", "", "path to the config file for this plugin")
+	return flags, configFile
+}
+
+func runInfo(args []string) error {
+	flags, configFile := newCommandFlags("info")
+	if flags.Parse(args) != nil || flags.NArg() != 0 {
+		return errUsage
+	}
+	plugin, err := loadPluginConfig(*configFile)
+	if err != nil {
+		return err
+	}
+	info, err := plugin.StoreInfo()
+	if err != nil {
+		return err
+	}
+	fmt.Printf("HAP store: %s\n", info.Path)
+	fmt.Printf("Device id: %s\n", info.DeviceID)
+	fmt.Printf("Accessory: %s\n", plugin.MonitorAccessoryName)
+	fmt.Printf("Pin: %s\n", info.Pin)
+	fmt.Printf("Setup URI: %s\n", info.SetupURI)
+	fmt.Printf("Pairings: %d\n", len(info.Pairings))
+	printPairings(info.Pairings)
+	return nil
+}
+
+func runPairings(args []string) error {
+	flags, configFile := newCommandFlags("pairings")
+	if flags.Parse(args) != nil || flags.NArg() < 1 {
+		return errUsage
+	}
+	plugin, err := loadPluginConfig(*configFile)
+	if err != nil {
+		return err
+	}
+	switch flags.Arg(0) {
+	case "list":
+		if flags.NArg() != 1 {
+			return errUsage
+		}
+		pairings, err := plugin.Pairings()
+		if err != nil {
+			return err
+		}
+		printPairings(pairings)
+	case "remove":
+		if flags.NArg() != 2 {
+			return errUsage
+		}
+		err = plugin.RemovePairing(flags.Arg(1))
+		if err != nil {
+			return err
+		}
+		fmt.Printf("Removed pairing: %s\n", flags.Arg(1))
+	default:
+		return errUsage
+	}
+	return nil
+}
+
+func printPairings(pairings []hap.Pairing) {
+	for _, pairing := range pairings {
+		permission := "user"
+		if pairing.Permission == hap.PermissionAdmin {
+			permission = "admin"
+		}
+		fmt.Printf("%s (%s)\n", pairing.Name, permission)
+	}
+}
+
+func runReset(args []string) error {
+	flags, configFile := newCommandFlags("reset")
+	force := flags.Bool("force", false, "reset the HAP store even if it contains unexpected entries")
+	if flags.Parse(args) != nil || flags.NArg() != 0 {
+		return errUsage
+	}
+	plugin, err := loadPluginConfig(*configFile)
+	if err != nil {
+		return err
+	}
+	err = plugin.ResetStore(*force)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Reset HAP store: %s\n", plugin.HAPStorePath)
+	return nil
+}
+
+var payloadContentTypes = map[string]string{
+	".json": "application/json",
+	".form": "application/x-www-form-urlencoded",
+	".txt":  "text/plain",
+	".lp":   "text/plain",
+	".csv":  "text/csv",
+}
+
+func runTest(args []string) error {
+	flags, configFile := newCommandFlags("test")
+	payloadFile := flags.String("payload", "", "path to the payload file to process")
+	contentType := flags.String("content-type", "", "content type of the payload (derived from the payload file extension by default)")
+	if flags.Parse(args) != nil || flags.NArg() != 0 || *payloadFile == "" {
+		return errUsage
+	}
+	plugin, err := loadPluginConfig(*configFile)
+	if err != nil {
+		return err
+	}
+	payload, err := os.ReadFile(*payloadFile)
+	if err != nil {
+		return err
+	}
+	if *contentType == "" {
+		*contentType = payloadContentTypes[strings.ToLower(filepath.Ext(*payloadFile))]
+		if *contentType == "" {
+			return fmt.Errorf("unknown content type of payload file %s (use -content-type)", *payloadFile)
+		}
+	}
+	collector := &metricCollector{}
+	payloadErrors, err := plugin.ProcessPayload(collector, *contentType, payload, time.Now())
+	if err != nil {
+		return err
+	}
+	err = printMetrics(collector)
+	if err != nil {
+		return err
+	}
+	for _, payloadError := range payloadErrors {
+		fmt.Printf("Error: %s = %s (cause: %s)\n", payloadError.Key, payloadError.Value, payloadError.Error)
+	}
+	if len(payloadErrors) > 0 {
+		return fmt.Errorf("%d payload field(s) rejected", len(payloadErrors))
+	}
+	return nil
+}
+
+func printMetrics(collector *metricCollector) error {
+	serializer := &influx.Serializer{SortFields: true}
+	err := serializer.Init()
+	if err != nil {
+		return err
+	}
+	for _, m := range collector.metrics {
+		line, err := serializer.Serialize(m)
+		if err != nil {
+			return err
+		}
+		os.Stdout.Write(line)
+	}
+	return nil
+}
+
+func runReplay(args []string) error {
+	flags, configFile := newCommandFlags("replay")
+	timestamps := flags.String("timestamps", "original", "timestamps to use for the replayed measurements (original or now)")
+	if flags.Parse(args) != nil || flags.NArg() == 0 || (*timestamps != "original" && *timestamps != "now") {
+		return errUsage
+	}
+	plugin, err := loadPluginConfig(*configFile)
+	if err != nil {
+		return err
+	}
+	records := make([]homekit.MonitorRecord, 0)
+	for _, recordFile := range flags.Args() {
+		fileRecords, err := readMonitorRecords(recordFile)
+		if err != nil {
+			return err
+		}
+		records = append(records, fileRecords...)
+	}
+	sort.SliceStable(records, func(i, j int) bool { return records[i].Time.Before(records[j].Time) })
+	var timeShift time.Duration
+	if *timestamps == "now" && len(records) > 0 {
+		timeShift = time.Since(records[0].Time)
+	}
+	collector := &metricCollector{}
+	rejected := 0
+	for _, record := range records {
+		payloadErrors, err := plugin.ProcessPayload(collector, record.Headers.Get("Content-Type"), []byte(record.Body), record.Time.Add(timeShift))
+		if err != nil {
+			fmt.Printf("Error: %s record from %s (cause: %v)\n", record.Time.Format(time.RFC3339), record.Remote, err)
+			rejected++
+			continue
+		}
+		for _, payloadError := range payloadErrors {
+			fmt.Printf("Error: %s record from %s: %s = %s (cause: %s)\n", record.Time.Format(time.RFC3339), record.Remote, payloadError.Key, payloadError.Value, payloadError.Error)
+		}
+		rejected += len(payloadErrors)
+	}
+	err = printMetrics(collector)
+	if err != nil {
+		return err
+	}
+	if rejected > 0 {
+		return fmt.Errorf("%d record(s) or field(s) rejected", rejected)
+	}
+	return nil
+}
+
+func readMonitorRecords(recordFile string) ([]homekit.MonitorRecord, error) {
+	file, err := os.Open(recordFile)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	return homekit.ReadMonitorRecords(file)
+}
+
+func runDiscover(args []string) error {
+	flags, _ := newCommandFlags("discover")
+	timeout := flags.Duration("timeout", 5*time.Second, "how long to wait for accessory advertisements")
+	if flags.Parse(args) != nil || flags.NArg() != 0 || *timeout <= 0 {
+		return errUsage
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), *timeout)
+	defer cancel()
+	accessories, err := homekit.Discover(ctx)
+	if err != nil {
+		return err
+	}
+	for _, discovered := range accessories {
+		pairing := "unpaired"
+		if discovered.Paired() {
+			pairing = "paired"
+		}
+		fmt.Printf("%s (id: %s, model: %s, category: %s, config: %d, %s) %s\n", discovered.Name, discovered.DeviceID, discovered.Model, discovered.CategoryName(), discovered.ConfigNumber, pairing, discovered.Address)
+	}
+	fmt.Printf("Accessories: %d\n", len(accessories))
+	return nil
+}
+
+// The environment variable providing the archive passphrase if no passphrase file is given
+const storePassphraseEnv = "HOMEKIT_STORE_PASSPHRASE"
+
+func newArchiveFlags(name string) (*flag.FlagSet, *string, *string, *string) {
+	flags, configFile := newCommandFlags(name)
+	archiveFile := flags.String("file", "", "path to the HAP store archive (default: the configured hap_store_backup_path)")
+	passphraseFile := flags.String("passphrase-file", "", "path to the file containing the archive passphrase")
+	return flags, configFile, archiveFile, passphraseFile
+}
+
+func readStorePassphrase(passphraseFile string) (string, error) {
+	if passphraseFile == "" {
+		return os.Getenv(storePassphraseEnv), nil
+	}
+	passphrase, err := os.ReadFile(passphraseFile)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimRight(string(passphrase), "\r\n"), nil
+}
+
+func runExport(args []string) error {
+	flags, configFile, archiveFile, passphraseFile := newArchiveFlags("export")
+	if flags.Parse(args) != nil || flags.NArg() != 0 {
+		return errUsage
+	}
+	plugin, err := loadPluginConfig(*configFile)
+	if err != nil {
+		return err
+	}
+	passphrase, err := readStorePassphrase(*passphraseFile)
+	if err != nil {
+		return err
+	}
+	if *archiveFile == "" {
+		*archiveFile = plugin.StoreBackupPath()
+	}
+	entries, err := plugin.ExportStoreFile(*archiveFile, passphrase)
+	if err != nil {
+		return err
+	}
+	encryption := "unencrypted"
+	if passphrase != "" {
+		encryption = "encrypted"
+	}
+	fmt.Printf("Exported HAP store: %s -> %s (%d entries, %s)\n", plugin.HAPStorePath, *archiveFile, entries, encryption)
+	return nil
+}
+
+func runImport(args []string) error {
+	flags, configFile, archiveFile, passphraseFile := newArchiveFlags("import")
+	force := flags.Bool("force", false, "replace the existing HAP store entries")
+	if flags.Parse(args) != nil || flags.NArg() != 0 {
+		return errUsage
+	}
+	plugin, err := loadPluginConfig(*configFile)
+	if err != nil {
+		return err
+	}
+	passphrase, err := readStorePassphrase(*passphraseFile)
+	if err != nil {
+		return err
+	}
+	if *archiveFile == "" {
+		*archiveFile = plugin.StoreBackupPath()
+	}
+	file, err := os.Open(*archiveFile)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	entries, err := plugin.ImportStore(file, passphrase, *force)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Imported HAP store: %s -> %s (%d entries)\n", *archiveFile, plugin.HAPStorePath, entries)
+	return nil
+}
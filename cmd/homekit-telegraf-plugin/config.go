@@ -0,0 +1,172 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"reflect"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+	"github.com/hdecarne-github/homekit-telegraf-plugin/plugins/inputs/homekit"
+	output "github.com/hdecarne-github/homekit-telegraf-plugin/plugins/outputs/homekit"
+	"github.com/influxdata/telegraf/plugins/common/shim"
+)
+
+const pluginName = "homekit"
+
+type pluginConfig struct {
+	Inputs  map[string][]toml.Primitive
+	Outputs map[string][]toml.Primitive
+}
+
+// missingSectionError indicates a config file without the requested plugin section.
+type missingSectionError struct {
+	section    string
+	configFile string
+}
+
+func (err *missingSectionError) Error() string {
+	return fmt.Sprintf("no %s section found in config file %s", err.section, err.configFile)
+}
+
+// loadPluginConfig loads and initializes the plugin settings from the given config file
+// the same way the shim does, but without starting the plugin.
+func loadPluginConfig(configFile string) (*homekit.HomeKit, error) {
+	plugin, err := decodePluginConfig(configFile)
+	if err != nil {
+		return nil, err
+	}
+	err = plugin.Init()
+	if err != nil {
+		return nil, err
+	}
+	return plugin, nil
+}
+
+// decodePluginConfig decodes the plugin settings from the given config file and fails on any unknown setting.
+func decodePluginConfig(configFile string) (*homekit.HomeKit, error) {
+	plugin := homekit.NewHomeKit()
+	plugin.Log = shim.NewLogger()
+	if configFile == "" {
+		return plugin, nil
+	}
+	err := decodeConfigSection(configFile, "inputs", plugin)
+	if err != nil {
+		return nil, err
+	}
+	return plugin, nil
+}
+
+// decodeOutputPluginConfig decodes the output plugin settings from the given config file and fails on any unknown setting.
+func decodeOutputPluginConfig(configFile string) (*output.HomeKit, error) {
+	plugin := output.NewHomeKit()
+	plugin.Log = shim.NewLogger()
+	err := decodeConfigSection(configFile, "outputs", plugin)
+	if err != nil {
+		return nil, err
+	}
+	return plugin, nil
+}
+
+func decodeConfigSection(configFile string, category string, plugin interface{}) error {
+	configBytes, err := os.ReadFile(configFile)
+	if err != nil {
+		return err
+	}
+	var config pluginConfig
+	md, err := toml.Decode(os.ExpandEnv(string(configBytes)), &config)
+	if err != nil {
+		return err
+	}
+	sections := config.Inputs
+	if category == "outputs" {
+		sections = config.Outputs
+	}
+	section := category + "." + pluginName
+	primitives, ok := sections[pluginName]
+	if !ok {
+		return &missingSectionError{section: section, configFile: configFile}
+	}
+	if len(primitives) > 0 {
+		err = md.PrimitiveDecode(primitives[0], plugin)
+		if err != nil {
+			return err
+		}
+	}
+	var unknownKeys []string
+	pluginType := reflect.TypeOf(plugin).Elem()
+	for _, undecoded := range md.Undecoded() {
+		key := undecoded.String()
+		if !strings.HasPrefix(key, section+".") {
+			continue
+		}
+		unknownKey := strings.TrimPrefix(key, section+".")
+		if suggestion := suggestPluginConfigKey(pluginType, unknownKey); suggestion != "" {
+			unknownKeys = append(unknownKeys, fmt.Sprintf("%s (did you mean '%s'?)", unknownKey, suggestion))
+		} else {
+			unknownKeys = append(unknownKeys, unknownKey)
+		}
+	}
+	if len(unknownKeys) > 0 {
+		return fmt.Errorf("unknown setting(s) in config file %s: %s", configFile, strings.Join(unknownKeys, ", "))
+	}
+	return nil
+}
+
+// suggestPluginConfigKey suggests the known setting most similar to the given unknown one. Unknown settings of
+// nested tables (e.g. trigger.intervall) are compared with the settings of the respective table.
+func suggestPluginConfigKey(pluginType reflect.Type, unknownKey string) string {
+	table, nestedKey, nested := strings.Cut(unknownKey, ".")
+	if nested {
+		for i := 0; i < pluginType.NumField(); i++ {
+			if pluginType.Field(i).Tag.Get("toml") != table {
+				continue
+			}
+			tableType := pluginType.Field(i).Type
+			for tableType.Kind() == reflect.Slice || tableType.Kind() == reflect.Pointer {
+				tableType = tableType.Elem()
+			}
+			if tableType.Kind() != reflect.Struct {
+				return ""
+			}
+			if suggestion := suggestPluginConfigKey(tableType, nestedKey); suggestion != "" {
+				return table + "." + suggestion
+			}
+		}
+		return ""
+	}
+	suggestion := ""
+	suggestionDistance := 4
+	for i := 0; i < pluginType.NumField(); i++ {
+		key := pluginType.Field(i).Tag.Get("toml")
+		if key == "" || pluginType.Field(i).Tag.Get("deprecated") != "" {
+			continue
+		}
+		distance := editDistance(unknownKey, key)
+		if distance < suggestionDistance {
+			suggestion = key
+			suggestionDistance = distance
+		}
+	}
+	return suggestion
+}
+
+func editDistance(a string, b string) int {
+	previous := make([]int, len(b)+1)
+	current := make([]int, len(b)+1)
+	for j := range previous {
+		previous[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		current[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			current[j] = min(previous[j]+1, current[j-1]+1, previous[j-1]+cost)
+		}
+		previous, current = current, previous
+	}
+	return previous[len(b)]
+}
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/hdecarne-github/homekit-telegraf-plugin/plugins/inputs/homekit"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDecodePluginConfig(t *testing.T) {
+	configs := map[string]struct {
+		config string
+		err    string
+	}{
+		"valid": {
+			config: `[[inputs.homekit]]
+  address = ":8001"
+  [[inputs.homekit.trigger]]
+    name = "Trigger"
+    interval = "1m"
+`,
+		},
+		"unknown key": {
+			config: `[[inputs.homekit]]
+  unknown_setting = true
+`,
+			err: "unknown setting(s) in config file %s: unknown_setting",
+		},
+		"misspelled key": {
+			config: `[[inputs.homekit]]
+  adress = ":8001"
+  monitor_pth = "/monitor"
+`,
+			err: "unknown setting(s) in config file %s: adress (did you mean 'address'?), monitor_pth (did you mean 'monitor_path'?)",
+		},
+		"misspelled nested key": {
+			config: `[[inputs.homekit]]
+  [[inputs.homekit.trigger]]
+    name = "Trigger"
+    intervall = "1m"
+`,
+			err: "unknown setting(s) in config file %s: trigger.intervall (did you mean 'trigger.interval'?)",
+		},
+		"missing section": {
+			config: `[[outputs.homekit]]
+  address = ":8002"
+`,
+			err: "no inputs.homekit section found in config file %s",
+		},
+	}
+	for name, config := range configs {
+		configFile := writeConfigFile(t, config.config)
+		_, err := decodePluginConfig(configFile)
+		if config.err == "" {
+			require.NoError(t, err, name)
+		} else {
+			require.EqualError(t, err, fmt.Sprintf(config.err, configFile), name)
+		}
+	}
+}
+
+func TestDecodeDeprecatedPluginConfig(t *testing.T) {
+	configFile := writeConfigFile(t, `[[inputs.homekit]]
+  celsius_suffixex = [" C"]
+`)
+	plugin, err := loadPluginConfig(configFile)
+	require.NoError(t, err)
+	require.Equal(t, []string{" C"}, plugin.CelsiusSuffixes)
+
+	// deprecated keys are never suggested
+	configFile = writeConfigFile(t, `[[inputs.homekit]]
+  celsius_sufixes = [" C"]
+`)
+	_, err = decodePluginConfig(configFile)
+	require.EqualError(t, err, fmt.Sprintf("unknown setting(s) in config file %s: celsius_sufixes (did you mean 'celsius_suffixes'?)", configFile))
+}
+
+func TestDecodeOutputPluginConfig(t *testing.T) {
+	configFile := writeConfigFile(t, `[[outputs.homekit]]
+  bridge_name = "Telegraf"
+  [[outputs.homekit.sensor]]
+    name = "CPU Temperature"
+    type = "temperature"
+    measurement = "temp"
+    feild = "temp"
+`)
+	_, err := decodeOutputPluginConfig(configFile)
+	require.EqualError(t, err, fmt.Sprintf("unknown setting(s) in config file %s: sensor.feild (did you mean 'sensor.field'?)", configFile))
+}
+
+func TestSuggestPluginConfigKey(t *testing.T) {
+	pluginType := reflect.TypeOf(homekit.HomeKit{})
+	suggestions := map[string]string{
+		"adress":             "address",
+		"monitor_pth":        "monitor_path",
+		"celsius_suffixex":   "celsius_suffixes",
+		"trigger.intervall":  "trigger.interval",
+		"sensor.sorces":      "sensor.sources",
+		"completely_unknown": "",
+		"unknown.interval":   "",
+		"address.port":       "",
+	}
+	for unknownKey, suggestion := range suggestions {
+		require.Equal(t, suggestion, suggestPluginConfigKey(pluginType, unknownKey), unknownKey)
+	}
+}
+
+func TestEditDistance(t *testing.T) {
+	require.Equal(t, 0, editDistance("address", "address"))
+	require.Equal(t, 1, editDistance("adress", "address"))
+	require.Equal(t, 2, editDistance("adresss", "adderss"))
+	require.Equal(t, 7, editDistance("", "address"))
+}
+
+func writeConfigFile(t *testing.T, config string) string {
+	configFile := filepath.Join(t.TempDir(), "homekit.conf")
+	require.NoError(t, os.WriteFile(configFile, []byte(config), 0600))
+	return configFile
+}
@@ -1,12 +1,14 @@
 package main
 
 import (
+	"errors"
 	"flag"
 	"fmt"
 	"os"
 	"time"
 
 	_ "github.com/hdecarne-github/homekit-telegraf-plugin/plugins/inputs/homekit"
+	_ "github.com/hdecarne-github/homekit-telegraf-plugin/plugins/outputs/homekit"
 
 	"github.com/influxdata/telegraf/plugins/common/shim"
 )
@@ -32,6 +34,13 @@ var err error
 //
 // // now the shim.Run() call as below. Note the shim is only intended to run a single plugin.
 func main() {
+	// run a maintenance command (e.g. pairings list) instead of the plugin
+	if len(os.Args) > 1 {
+		if _, ok := commands[os.Args[1]]; ok {
+			os.Exit(runCommand(os.Args[1], os.Args[2:]))
+		}
+	}
+
 	// parse command line options
 	flag.Parse()
 	if *pollIntervalDisabled {
@@ -45,6 +54,21 @@ func main() {
 	// otherwise, follow what the config asks for.
 	// Check for settings from a config toml file,
 	// (or just use whatever plugins were imported above)
+	if *configFile != "" {
+		// fail early on unknown (e.g. misspelled) settings, the shim silently ignores them
+		_, err = decodePluginConfig(*configFile)
+		var missingSection *missingSectionError
+		if errors.As(err, &missingSection) {
+			// no input section; run as output plugin if configured
+			if _, outputErr := decodeOutputPluginConfig(*configFile); !errors.As(outputErr, &missingSection) {
+				err = outputErr
+			}
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Err loading input: %s\n", err)
+			os.Exit(1)
+		}
+	}
 	err = shimLayer.LoadConfig(configFile)
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "Err loading input: %s\n", err)
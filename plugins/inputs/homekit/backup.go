@@ -0,0 +1,328 @@
+// backup.go
+//
+// Copyright (C) 2023-2024 Holger de Carne
+//
+// This software may be modified and distributed under the terms
+// of the MIT license.  See the LICENSE file for details.
+
+package homekit
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/brutella/hap"
+)
+
+const storeArchiveFormat = "homekit-telegraf-plugin/hap-store"
+const storeArchiveVersion = 1
+const storeBackupSuffix = ".backup"
+const storeNewSuffix = ".new"
+const storeReplacedSuffix = ".replaced"
+
+type storeArchive struct {
+	Format     string            `json:"format"`
+	Version    int               `json:"version"`
+	Created    time.Time         `json:"created"`
+	Entries    map[string][]byte `json:"entries,omitempty"`
+	Encryption *storeEncryption  `json:"encryption,omitempty"`
+	Data       []byte            `json:"data,omitempty"`
+}
+
+// ExportStore writes all entries of the configured HAP store to a single versioned archive. If a passphrase is
+// given, the entries are encrypted using a key derived from the passphrase.
+func (plugin *HomeKit) ExportStore(w io.Writer, passphrase string) (int, error) {
+	store, err := plugin.openStore(false)
+	if err != nil {
+		return 0, err
+	}
+	defer CloseHAPStore(store)
+	entries, err := storeEntries(store)
+	if err != nil {
+		return 0, err
+	}
+	archive := &storeArchive{
+		Format:  storeArchiveFormat,
+		Version: storeArchiveVersion,
+		Created: time.Now().UTC(),
+	}
+	if passphrase == "" {
+		archive.Entries = entries
+	} else {
+		err = archive.encrypt(entries, passphrase)
+		if err != nil {
+			return 0, err
+		}
+	}
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return len(entries), encoder.Encode(archive)
+}
+
+// ExportStoreFile exports the configured HAP store to the given archive file. An existing archive file is only
+// replaced once the export has succeeded.
+func (plugin *HomeKit) ExportStoreFile(archivePath string, passphrase string) (int, error) {
+	var archive bytes.Buffer
+	entries, err := plugin.ExportStore(&archive, passphrase)
+	if err != nil {
+		return 0, err
+	}
+	return entries, writeFileAtomic(archivePath, archive.Bytes())
+}
+
+// ImportStore restores the entries of the given archive into the configured HAP store. The import is only
+// performed if the HAP server is not running and (unless forced) the HAP store does not yet contain any entries.
+// A forced import replaces all existing entries. The archive is validated completely and written to a new HAP
+// store, which replaces the configured one only once the import has succeeded.
+func (plugin *HomeKit) ImportStore(r io.Reader, passphrase string, force bool) (int, error) {
+	var archive storeArchive
+	err := json.NewDecoder(r).Decode(&archive)
+	if err != nil {
+		return 0, fmt.Errorf("invalid HAP store archive (cause: %v)", err)
+	}
+	if archive.Format != storeArchiveFormat {
+		return 0, fmt.Errorf("invalid HAP store archive (unexpected format '%s')", archive.Format)
+	}
+	if archive.Version > storeArchiveVersion {
+		return 0, fmt.Errorf("unsupported HAP store archive version %d", archive.Version)
+	}
+	entries := archive.Entries
+	if archive.Encryption != nil {
+		if passphrase == "" {
+			return 0, errors.New("HAP store archive is encrypted; a passphrase is required")
+		}
+		entries, err = archive.decrypt(passphrase)
+		if err != nil {
+			return 0, err
+		}
+	}
+	err = validateStoreEntries(entries)
+	if err != nil {
+		return 0, err
+	}
+	err = plugin.checkServerStopped("importing")
+	if err != nil {
+		return 0, err
+	}
+	if !force {
+		existing, err := plugin.storeEntryCount()
+		if err != nil {
+			return 0, err
+		}
+		if existing > 0 {
+			return 0, fmt.Errorf("HAP store %s is not empty; refusing to overwrite it", plugin.HAPStorePath)
+		}
+	}
+	err = plugin.replaceStore(entries)
+	if err != nil {
+		return 0, err
+	}
+	return len(entries), nil
+}
+
+func validateStoreEntries(entries map[string][]byte) error {
+	if len(entries) == 0 {
+		return errors.New("HAP store archive contains no entries")
+	}
+	for key, value := range entries {
+		if !isStoreKey(key) || key == encryptionKey {
+			return fmt.Errorf("unexpected HAP store archive entry '%s'", key)
+		}
+		if len(value) == 0 {
+			return fmt.Errorf("empty HAP store archive entry '%s'", key)
+		}
+		if strings.HasSuffix(key, pairingKeySuffix) {
+			var pairing hap.Pairing
+			err := json.Unmarshal(value, &pairing)
+			if err != nil {
+				return fmt.Errorf("invalid HAP store archive entry '%s' (cause: %v)", key, err)
+			}
+		}
+	}
+	return nil
+}
+
+// storeEntryCount counts the entries of the configured HAP store (0 if the HAP store does not exist).
+func (plugin *HomeKit) storeEntryCount() (int, error) {
+	_, err := os.Stat(plugin.HAPStorePath)
+	if errors.Is(err, os.ErrNotExist) {
+		return 0, nil
+	}
+	store, err := plugin.openStore(false)
+	if err != nil {
+		return 0, err
+	}
+	defer CloseHAPStore(store)
+	keys, err := store.KeysWithSuffix("")
+	if err != nil {
+		return 0, err
+	}
+	return len(keys), nil
+}
+
+// replaceStore replaces the configured HAP store with a new HAP store containing the given entries. The new
+// HAP store is written next to the configured one and swapped in once it is complete.
+func (plugin *HomeKit) replaceStore(entries map[string][]byte) error {
+	path := filepath.Clean(plugin.HAPStorePath)
+	newPath := path + storeNewSuffix
+	err := os.RemoveAll(newPath)
+	if err != nil {
+		return err
+	}
+	err = plugin.writeStore(newPath, entries)
+	if err != nil {
+		os.RemoveAll(newPath)
+		return err
+	}
+	return swapStore(path, newPath)
+}
+
+func (plugin *HomeKit) writeStore(path string, entries map[string][]byte) error {
+	store, err := OpenHAPStore(plugin.HAPStoreType, path)
+	if err != nil {
+		return err
+	}
+	defer CloseHAPStore(store)
+	wrappedStore, err := plugin.wrapStore(store)
+	if err != nil {
+		return err
+	}
+	for key, value := range entries {
+		err = wrappedStore.Set(key, value)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// swapStore moves the HAP store at newPath to path. An existing HAP store at path is restored if the swap fails.
+func swapStore(path string, newPath string) error {
+	replacedPath := path + storeReplacedSuffix
+	err := os.RemoveAll(replacedPath)
+	if err != nil {
+		return err
+	}
+	err = os.Rename(path, replacedPath)
+	replaced := err == nil
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	err = os.Rename(newPath, path)
+	if err != nil {
+		if replaced {
+			os.Rename(replacedPath, path)
+		}
+		return err
+	}
+	if replaced {
+		return os.RemoveAll(replacedPath)
+	}
+	return nil
+}
+
+// writeFileAtomic writes the given data to a temporary file next to the given file and renames it to the given
+// file once it has been written completely.
+func writeFileAtomic(path string, data []byte) error {
+	file, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*")
+	if err != nil {
+		return err
+	}
+	_, err = file.Write(data)
+	if err == nil {
+		err = file.Sync()
+	}
+	closeErr := file.Close()
+	if err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(file.Name(), path)
+	}
+	if err != nil {
+		os.Remove(file.Name())
+	}
+	return err
+}
+
+func (archive *storeArchive) encrypt(entries map[string][]byte, passphrase string) error {
+	encryption, err := newStoreEncryption()
+	if err != nil {
+		return err
+	}
+	aead, err := encryption.aead([]byte(passphrase))
+	if err != nil {
+		return err
+	}
+	plaintext, err := json.Marshal(entries)
+	if err != nil {
+		return err
+	}
+	archive.Encryption = encryption
+	archive.Data = aead.Seal(nil, encryption.Nonce, plaintext, []byte(archive.Format))
+	return nil
+}
+
+func (archive *storeArchive) decrypt(passphrase string) (map[string][]byte, error) {
+	aead, err := archive.Encryption.aead([]byte(passphrase))
+	if err != nil {
+		return nil, err
+	}
+	plaintext, err := aead.Open(nil, archive.Encryption.Nonce, archive.Data, []byte(archive.Format))
+	if err != nil {
+		return nil, errors.New("failed to decrypt HAP store archive (wrong passphrase?)")
+	}
+	var entries map[string][]byte
+	err = json.Unmarshal(plaintext, &entries)
+	if err != nil {
+		return nil, fmt.Errorf("invalid HAP store archive (cause: %v)", err)
+	}
+	return entries, nil
+}
+
+func storeEntries(store hap.Store) (map[string][]byte, error) {
+	keys, err := store.KeysWithSuffix("")
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(keys)
+	entries := make(map[string][]byte, len(keys))
+	for _, key := range keys {
+		value, err := store.Get(key)
+		if err != nil {
+			return nil, err
+		}
+		entries[key] = value
+	}
+	return entries, nil
+}
+
+// StoreBackupPath gets the path of the HAP store backup archive (default: <hap_store_path>.backup).
+func (plugin *HomeKit) StoreBackupPath() string {
+	if plugin.HAPStoreBackupPath != "" {
+		return plugin.HAPStoreBackupPath
+	}
+	return plugin.HAPStorePath + storeBackupSuffix
+}
+
+// checkStoreBackup warns if the HAP store is missing while a backup archive exists, as starting with an empty
+// HAP store requires the accessory to be paired again.
+func (plugin *HomeKit) checkStoreBackup() {
+	_, err := os.Stat(plugin.HAPStorePath)
+	if !errors.Is(err, os.ErrNotExist) {
+		return
+	}
+	backupPath := plugin.StoreBackupPath()
+	_, err = os.Stat(backupPath)
+	if err == nil {
+		plugin.Log.Warnf("HAP store %s is missing but backup %s exists; stop the plugin and run the import command to restore the existing pairings", plugin.HAPStorePath, backupPath)
+	}
+}
@@ -0,0 +1,168 @@
+// backup_test.go
+//
+// # Copyright (C) 2023-2024 Holger de Carne
+//
+// This software may be modified and distributed under the terms
+// of the MIT license.  See the LICENSE file for details.
+package homekit
+
+import (
+	"bytes"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/brutella/hap"
+	"github.com/stretchr/testify/require"
+)
+
+func TestExportImportStore(t *testing.T) {
+	source := NewHomeKit()
+	source.Address = freeAddress(t)
+	source.HAPStorePath = filepath.Join(t.TempDir(), ".hap")
+	source.Log = createDummyLogger()
+
+	var archive bytes.Buffer
+	_, err := source.ExportStore(&archive, "")
+	require.Error(t, err)
+
+	store, err := source.openStore(true)
+	require.NoError(t, err)
+	require.NoError(t, store.Set(uuidKey, []byte("00:11:22:33:44:55")))
+	require.NoError(t, store.Set("keypair", []byte(`{"Public":"AQI=","Private":"AwQ="}`)))
+	savePairing(t, store, hap.Pairing{Name: "Controller1", Permission: hap.PermissionAdmin})
+
+	for _, passphrase := range []string{"", "secret"} {
+		archive.Reset()
+		exported, err := source.ExportStore(&archive, passphrase)
+		require.NoError(t, err)
+		require.Equal(t, 3, exported)
+		require.Equal(t, passphrase == "", strings.Contains(archive.String(), `"keypair"`))
+
+		target := NewHomeKit()
+		target.Address = freeAddress(t)
+		target.HAPStorePath = filepath.Join(t.TempDir(), ".hap")
+		target.Log = createDummyLogger()
+		if passphrase != "" {
+			_, err = target.ImportStore(bytes.NewReader(archive.Bytes()), "", false)
+			require.Error(t, err)
+			_, err = target.ImportStore(bytes.NewReader(archive.Bytes()), "wrong", false)
+			require.Error(t, err)
+		}
+		imported, err := target.ImportStore(bytes.NewReader(archive.Bytes()), passphrase, false)
+		require.NoError(t, err)
+		require.Equal(t, 3, imported)
+		info, err := target.StoreInfo()
+		require.NoError(t, err)
+		require.Equal(t, "00:11:22:33:44:55", info.DeviceID)
+		require.Len(t, info.Pairings, 1)
+		require.Equal(t, "Controller1", info.Pairings[0].Name)
+
+		_, err = target.ImportStore(bytes.NewReader(archive.Bytes()), passphrase, false)
+		require.Error(t, err)
+		imported, err = target.ImportStore(bytes.NewReader(archive.Bytes()), passphrase, true)
+		require.NoError(t, err)
+		require.Equal(t, 3, imported)
+	}
+}
+
+func TestImportInvalidArchive(t *testing.T) {
+	plugin := NewHomeKit()
+	plugin.Address = freeAddress(t)
+	plugin.HAPStorePath = filepath.Join(t.TempDir(), ".hap")
+	plugin.Log = createDummyLogger()
+
+	archives := []string{
+		`not json`,
+		`{"format":"other","version":1,"entries":{"uuid":"AQI="}}`,
+		`{"format":"homekit-telegraf-plugin/hap-store","version":2,"entries":{"uuid":"AQI="}}`,
+		`{"format":"homekit-telegraf-plugin/hap-store","version":1}`,
+		`{"format":"homekit-telegraf-plugin/hap-store","version":1,"entries":{"unexpected":"AQI="}}`,
+	}
+	for _, archive := range archives {
+		_, err := plugin.ImportStore(strings.NewReader(archive), "", true)
+		require.Error(t, err, archive)
+	}
+}
+
+func TestExportStoreFileKeepsArchive(t *testing.T) {
+	plugin := NewHomeKit()
+	plugin.Address = freeAddress(t)
+	plugin.HAPStorePath = filepath.Join(t.TempDir(), ".hap")
+	plugin.Log = createDummyLogger()
+	store, err := plugin.openStore(true)
+	require.NoError(t, err)
+	require.NoError(t, store.Set(uuidKey, []byte("00:11:22:33:44:55")))
+
+	archivePath := plugin.StoreBackupPath()
+	exported, err := plugin.ExportStoreFile(archivePath, "")
+	require.NoError(t, err)
+	require.Equal(t, 1, exported)
+	archive, err := os.ReadFile(archivePath)
+	require.NoError(t, err)
+
+	require.NoError(t, os.RemoveAll(plugin.HAPStorePath))
+	_, err = plugin.ExportStoreFile(archivePath, "")
+	require.Error(t, err)
+	unchanged, err := os.ReadFile(archivePath)
+	require.NoError(t, err)
+	require.Equal(t, archive, unchanged)
+	entries, err := os.ReadDir(filepath.Dir(archivePath))
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+}
+
+func TestForcedImportKeepsStoreOnInvalidArchive(t *testing.T) {
+	plugin := NewHomeKit()
+	plugin.Address = freeAddress(t)
+	plugin.HAPStorePath = filepath.Join(t.TempDir(), ".hap")
+	plugin.Log = createDummyLogger()
+	store, err := plugin.openStore(true)
+	require.NoError(t, err)
+	require.NoError(t, store.Set(uuidKey, []byte("00:11:22:33:44:55")))
+	require.NoError(t, store.Set("schema", []byte("1")))
+
+	archives := []string{
+		`{"format":"homekit-telegraf-plugin/hap-store","version":1,"entries":{"uuid":"AQI=","evil":"AQI="}}`,
+		`{"format":"homekit-telegraf-plugin/hap-store","version":1,"entries":{"uuid":"AQI=","encryption":"AQI="}}`,
+		`{"format":"homekit-telegraf-plugin/hap-store","version":1,"entries":{"uuid":"AQI=","schema":""}}`,
+		`{"format":"homekit-telegraf-plugin/hap-store","version":1,"entries":{"uuid":"AQI=","41.pairing":"AQI="}}`,
+	}
+	for _, archive := range archives {
+		_, err := plugin.ImportStore(strings.NewReader(archive), "", true)
+		require.Error(t, err, archive)
+		info, err := plugin.StoreInfo()
+		require.NoError(t, err)
+		require.Equal(t, "00:11:22:33:44:55", info.DeviceID)
+		schema, err := store.Get("schema")
+		require.NoError(t, err)
+		require.Equal(t, "1", string(schema))
+	}
+}
+
+func TestForcedImportWhileRunning(t *testing.T) {
+	listener, err := net.Listen("tcp", "localhost:0")
+	require.NoError(t, err)
+	defer listener.Close()
+	plugin := NewHomeKit()
+	plugin.Address = listener.Addr().String()
+	plugin.HAPStorePath = filepath.Join(t.TempDir(), ".hap")
+	plugin.Log = createDummyLogger()
+
+	archive := `{"format":"homekit-telegraf-plugin/hap-store","version":1,"entries":{"uuid":"AQI="}}`
+	_, err = plugin.ImportStore(strings.NewReader(archive), "", true)
+	require.ErrorContains(t, err, "stop the plugin")
+	require.NoDirExists(t, plugin.HAPStorePath)
+	require.NoError(t, os.MkdirAll(plugin.HAPStorePath, 0750))
+	require.ErrorContains(t, plugin.ResetStore(true), "stop the plugin")
+	require.DirExists(t, plugin.HAPStorePath)
+}
+
+func TestStoreBackupPath(t *testing.T) {
+	plugin := NewHomeKit()
+	require.Equal(t, ".hap.backup", plugin.StoreBackupPath())
+	plugin.HAPStoreBackupPath = "/backup/hap.json"
+	require.Equal(t, "/backup/hap.json", plugin.StoreBackupPath())
+}
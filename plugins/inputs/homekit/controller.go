@@ -0,0 +1,513 @@
+// controller.go
+//
+// Copyright (C) 2023-2024 Holger de Carne
+//
+// This software may be modified and distributed under the terms
+// of the MIT license.  See the LICENSE file for details.
+
+package homekit
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/brutella/dnssd"
+	"github.com/brutella/hap"
+	"github.com/brutella/hap/characteristic"
+	"github.com/brutella/hap/service"
+	"github.com/influxdata/telegraf"
+)
+
+const controllerKey = "controller"
+const accessoryPairingKeySuffix = ".accessory"
+const hapServiceType = "_hap._tcp.local."
+
+// AccessoryConfig defines an accessory to poll directly (controller mode).
+type AccessoryConfig struct {
+	Name    string   `toml:"name"`
+	Address string   `toml:"address"`
+	Pin     string   `toml:"pin"`
+	Room    string   `toml:"room"`
+	Events  []string `toml:"events"`
+}
+
+type controllerIdentity struct {
+	ID         string             `json:"id"`
+	PublicKey  ed25519.PublicKey  `json:"public_key"`
+	PrivateKey ed25519.PrivateKey `json:"private_key"`
+}
+
+type accessoryPairing struct {
+	ID        string `json:"id"`
+	PublicKey []byte `json:"public_key"`
+	Address   string `json:"address"`
+}
+
+type remoteAccessory struct {
+	config   AccessoryConfig
+	client   *hapClient
+	closed   <-chan struct{}
+	readings map[string]*remoteReading
+	ids      []string
+	mutex    sync.Mutex
+}
+
+type remoteReading struct {
+	name           string
+	characteristic string
+	process        func(plugin *HomeKit, value interface{}) (string, map[string]interface{}, error)
+}
+
+type remoteCharacteristic struct {
+	characteristic string
+	process        func(plugin *HomeKit, value interface{}) (string, map[string]interface{}, error)
+}
+
+var remoteCharacteristics = map[string]remoteCharacteristic{
+	characteristic.TypeCurrentTemperature:       {characteristic: "Temperature", process: processRemoteCelsius},
+	characteristic.TypeCurrentAmbientLightLevel: {characteristic: "LightLevel", process: processRemoteLux},
+	characteristic.TypeHue:                      {characteristic: "Hue", process: processRemoteHue},
+	characteristic.TypeOn:                       {characteristic: "On", process: processRemoteState},
+	characteristic.TypeActive:                   {characteristic: "Active", process: processRemoteState},
+	characteristic.TypeMotionDetected:           {characteristic: "Motion", process: processRemoteState},
+	characteristic.TypeOccupancyDetected:        {characteristic: "Occupancy", process: processRemoteState},
+	characteristic.TypeContactSensorState:       {characteristic: "Contact", process: processRemoteState},
+}
+
+func loadOrCreateControllerIdentity(store hap.Store) (*controllerIdentity, error) {
+	identityBytes, err := store.Get(controllerKey)
+	if err == nil {
+		identity := &controllerIdentity{}
+		err = json.Unmarshal(identityBytes, identity)
+		if err == nil && len(identity.PublicKey) == ed25519.PublicKeySize && len(identity.PrivateKey) == ed25519.PrivateKeySize {
+			return identity, nil
+		}
+	}
+	id, err := newControllerID()
+	if err != nil {
+		return nil, err
+	}
+	publicKey, privateKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	identity := &controllerIdentity{ID: id, PublicKey: publicKey, PrivateKey: privateKey}
+	identityBytes, err = json.Marshal(identity)
+	if err != nil {
+		return nil, err
+	}
+	err = store.Set(controllerKey, identityBytes)
+	if err != nil {
+		return nil, err
+	}
+	return identity, nil
+}
+
+func accessoryPairingKey(name string) string {
+	return hex.EncodeToString([]byte(name)) + accessoryPairingKeySuffix
+}
+
+func loadAccessoryPairing(store hap.Store, name string) *accessoryPairing {
+	pairingBytes, err := store.Get(accessoryPairingKey(name))
+	if err != nil {
+		return nil
+	}
+	pairing := &accessoryPairing{}
+	err = json.Unmarshal(pairingBytes, pairing)
+	if err != nil {
+		return nil
+	}
+	return pairing
+}
+
+func saveAccessoryPairing(store hap.Store, name string, pairing *accessoryPairing) error {
+	pairingBytes, err := json.Marshal(pairing)
+	if err != nil {
+		return err
+	}
+	return store.Set(accessoryPairingKey(name), pairingBytes)
+}
+
+func (plugin *HomeKit) setupRemoteAccessories() error {
+	if len(plugin.Accessories) == 0 {
+		return nil
+	}
+	identity, err := loadOrCreateControllerIdentity(plugin.store)
+	if err != nil {
+		return err
+	}
+	plugin.Log.Infof("Polling %d accessories as controller: %s", len(plugin.Accessories), identity.ID)
+	plugin.controller = identity
+	plugin.remoteAccessories = make([]*remoteAccessory, 0, len(plugin.Accessories))
+	for _, accessoryConfig := range plugin.Accessories {
+		plugin.remoteAccessories = append(plugin.remoteAccessories, &remoteAccessory{config: accessoryConfig})
+	}
+	return nil
+}
+
+func (plugin *HomeKit) closeRemoteAccessories() {
+	for _, remote := range plugin.remoteAccessories {
+		remote.mutex.Lock()
+		remote.close()
+		remote.mutex.Unlock()
+	}
+}
+
+// startPolling starts polling the remote accessories in the background, so a slow or unreachable accessory never
+// delays Gather. Every Gather requests a poll cycle; requests arriving while a cycle is running are coalesced.
+func (plugin *HomeKit) startPolling(ctx context.Context) {
+	if len(plugin.remoteAccessories) == 0 {
+		return
+	}
+	plugin.pollRequests = make(chan struct{}, 1)
+	plugin.serverStopped.Add(1)
+	go func() {
+		defer plugin.serverStopped.Done()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-plugin.pollRequests:
+				plugin.pollRemoteAccessories(plugin.acc)
+			}
+		}
+	}()
+}
+
+func (plugin *HomeKit) requestPoll() {
+	if plugin.pollRequests == nil {
+		return
+	}
+	select {
+	case plugin.pollRequests <- struct{}{}:
+	default:
+		if plugin.Debug {
+			plugin.Log.Infof("Skipping poll of remote accessories (still running)")
+		}
+	}
+}
+
+func (plugin *HomeKit) pollRemoteAccessories(acc telegraf.Accumulator) {
+	var polling sync.WaitGroup
+	for _, remote := range plugin.remoteAccessories {
+		polling.Add(1)
+		go func(remote *remoteAccessory) {
+			defer polling.Done()
+			remote.mutex.Lock()
+			defer remote.mutex.Unlock()
+			err := plugin.pollRemoteAccessory(acc, remote)
+			if err != nil {
+				acc.AddError(fmt.Errorf("failed to poll accessory '%s' (cause: %w)", remote.config.Name, err))
+				remote.close()
+			}
+		}(remote)
+	}
+	polling.Wait()
+}
+
+func (plugin *HomeKit) pollRemoteAccessory(acc telegraf.Accumulator, remote *remoteAccessory) error {
+	if remote.client != nil && remote.isClosed() {
+		plugin.Log.Infof("Lost connection to accessory '%s'; reconnecting", remote.config.Name)
+		remote.close()
+	}
+	if remote.client == nil {
+		err := plugin.connectRemoteAccessory(remote)
+		if err != nil {
+			return err
+		}
+	}
+	if len(remote.ids) == 0 {
+		return nil
+	}
+	characteristics, err := remote.client.getCharacteristics(remote.ids)
+	if err != nil {
+		return err
+	}
+	plugin.addRemoteReadings(acc, remote.room(), remote.readings, characteristics, time.Now())
+	return nil
+}
+
+func (plugin *HomeKit) addRemoteReadings(acc telegraf.Accumulator, room string, readings map[string]*remoteReading, characteristics *hapCharacteristics, timestamp time.Time) {
+	for _, remoteCharacteristic := range characteristics.Characteristics {
+		reading := readings[fmt.Sprintf("%d.%d", remoteCharacteristic.Aid, remoteCharacteristic.Iid)]
+		if reading == nil || remoteCharacteristic.Status != 0 || remoteCharacteristic.Value == nil {
+			continue
+		}
+		measurement, fields, err := reading.process(plugin, remoteCharacteristic.Value)
+		if err != nil {
+			plugin.Log.Warnf("Ignoring invalid accessory value: %s/%s = %v (cause: %v)", reading.name, reading.characteristic, remoteCharacteristic.Value, err)
+			continue
+		}
+		tags := make(map[string]string)
+		tags["homekit_monitor"] = plugin.MonitorAccessoryName
+		tags["homekit_name"] = reading.name
+		tags["homekit_room"] = room
+		tags["homekit_characteristic"] = reading.characteristic
+		acc.AddCounter(measurement, fields, tags, timestamp)
+	}
+}
+
+func (plugin *HomeKit) connectRemoteAccessory(remote *remoteAccessory) error {
+	pairing := loadAccessoryPairing(plugin.store, remote.config.Name)
+	if pairing == nil {
+		var err error
+		pairing, err = plugin.pairRemoteAccessory(remote.config)
+		if err != nil {
+			return err
+		}
+	}
+	client, err := plugin.verifyRemoteAccessory(remote.config, pairing)
+	if errors.Is(err, errPairingRejected) {
+		// The accessory has been reset or paired elsewhere; drop the stale pairing to pair again on the next poll
+		deleteErr := plugin.store.Delete(accessoryPairingKey(remote.config.Name))
+		if deleteErr != nil {
+			plugin.Log.Warnf("Failed to remove pairing of accessory '%s' (cause: %v)", remote.config.Name, deleteErr)
+		}
+		return fmt.Errorf("stored pairing rejected; pairing again on next poll (reset the accessory if it is paired with another controller) (cause: %w)", err)
+	}
+	if err != nil {
+		return err
+	}
+	accessories, err := client.getAccessories()
+	if err != nil {
+		client.close()
+		return err
+	}
+	readings := make(map[string]*remoteReading)
+	ids := make([]string, 0)
+	subscriptions := make([]hapCharacteristic, 0)
+	for _, accessoryData := range accessories.Accessories {
+		name := remote.config.Name
+		for _, serviceData := range accessoryData.Services {
+			if hapShortType(serviceData.Type) != service.TypeAccessoryInformation {
+				continue
+			}
+			for _, characteristicData := range serviceData.Characteristics {
+				if hapShortType(characteristicData.Type) == characteristic.TypeName {
+					if accessoryName, ok := characteristicData.Value.(string); ok && accessoryName != "" {
+						name = accessoryName
+					}
+				}
+			}
+		}
+		for _, serviceData := range accessoryData.Services {
+			for _, characteristicData := range serviceData.Characteristics {
+				mapping, ok := remoteCharacteristics[hapShortType(characteristicData.Type)]
+				if !ok || !hasPermission(characteristicData.Perms, characteristic.PermissionRead) {
+					continue
+				}
+				id := fmt.Sprintf("%d.%d", accessoryData.Aid, characteristicData.Iid)
+				readings[id] = &remoteReading{name: name, characteristic: mapping.characteristic, process: mapping.process}
+				ids = append(ids, id)
+				if remote.isEventCharacteristic(mapping.characteristic) && hasPermission(characteristicData.Perms, characteristic.PermissionEvents) {
+					subscriptions = append(subscriptions, hapCharacteristic{Aid: accessoryData.Aid, Iid: characteristicData.Iid, Events: true})
+				}
+			}
+		}
+	}
+	var closed <-chan struct{}
+	if len(subscriptions) > 0 {
+		room := remote.room()
+		closed, err = client.receiveEvents(func(characteristics *hapCharacteristics) {
+			if plugin.Debug {
+				plugin.Log.Infof("Received %d events from accessory '%s'", len(characteristics.Characteristics), remote.config.Name)
+			}
+			plugin.addRemoteReadings(plugin.acc, room, readings, characteristics, time.Now())
+		})
+		if err == nil {
+			err = client.subscribeCharacteristics(subscriptions)
+		}
+		if err != nil {
+			client.close()
+			return fmt.Errorf("failed to subscribe events (cause: %w)", err)
+		}
+	}
+	remote.client = client
+	remote.closed = closed
+	remote.readings = readings
+	remote.ids = ids
+	plugin.Log.Infof("Connected to accessory '%s' (%s) with %d readings and %d event subscriptions", remote.config.Name, client.address, len(ids), len(subscriptions))
+	return nil
+}
+
+func (plugin *HomeKit) pairRemoteAccessory(accessoryConfig AccessoryConfig) (*accessoryPairing, error) {
+	address, err := plugin.resolveRemoteAccessory(accessoryConfig)
+	if err != nil {
+		return nil, err
+	}
+	plugin.Log.Infof("Pairing accessory '%s' (%s)", accessoryConfig.Name, address)
+	pin, err := normalizePin(accessoryConfig.Pin)
+	if err != nil {
+		return nil, err
+	}
+	client, err := dialHAP(plugin.serverCtx, address, time.Duration(plugin.ControllerTimeout))
+	if err != nil {
+		return nil, err
+	}
+	defer client.close()
+	pairing, err := client.pairSetup(plugin.controller, formatPin(pin))
+	if err != nil {
+		return nil, fmt.Errorf("pair setup failed (cause: %w)", err)
+	}
+	err = saveAccessoryPairing(plugin.store, accessoryConfig.Name, pairing)
+	if err != nil {
+		return nil, err
+	}
+	return pairing, nil
+}
+
+func (plugin *HomeKit) verifyRemoteAccessory(accessoryConfig AccessoryConfig, pairing *accessoryPairing) (*hapClient, error) {
+	address := pairing.Address
+	if accessoryConfig.Address != "" {
+		address = accessoryConfig.Address
+	}
+	client, err := dialHAP(plugin.serverCtx, address, time.Duration(plugin.ControllerTimeout))
+	if err != nil && accessoryConfig.Address == "" {
+		// The accessory may have changed its address; try to rediscover it
+		address, err = plugin.resolveRemoteAccessory(accessoryConfig)
+		if err != nil {
+			return nil, err
+		}
+		client, err = dialHAP(plugin.serverCtx, address, time.Duration(plugin.ControllerTimeout))
+	}
+	if err != nil {
+		return nil, err
+	}
+	err = client.pairVerify(plugin.controller, pairing)
+	if err != nil {
+		client.close()
+		return nil, fmt.Errorf("pair verify failed (cause: %w)", err)
+	}
+	if pairing.Address != address {
+		pairing.Address = address
+		err = saveAccessoryPairing(plugin.store, accessoryConfig.Name, pairing)
+		if err != nil {
+			plugin.Log.Warnf("Failed to update pairing of accessory '%s' (cause: %v)", accessoryConfig.Name, err)
+		}
+	}
+	return client, nil
+}
+
+// resolveRemoteAccessory determines the address of the given accessory, either by using the configured address
+// or by discovering the accessory (via its name or device id) using DNS-SD.
+func (plugin *HomeKit) resolveRemoteAccessory(accessoryConfig AccessoryConfig) (string, error) {
+	if accessoryConfig.Address != "" {
+		return accessoryConfig.Address, nil
+	}
+	ctx, cancel := context.WithTimeout(plugin.serverCtx, time.Duration(plugin.ControllerTimeout))
+	defer cancel()
+	var address string
+	add := func(entry dnssd.BrowseEntry) {
+		if len(entry.IPs) == 0 || (entry.Name != accessoryConfig.Name && !strings.EqualFold(entry.Text["id"], accessoryConfig.Name)) {
+			return
+		}
+		address = net.JoinHostPort(entry.IPs[0].String(), strconv.Itoa(entry.Port))
+		cancel()
+	}
+	err := dnssd.LookupType(ctx, hapServiceType, add, func(dnssd.BrowseEntry) {})
+	if address != "" {
+		return address, nil
+	}
+	if err != nil && ctx.Err() == nil {
+		return "", err
+	}
+	return "", fmt.Errorf("accessory not found")
+}
+
+func (remote *remoteAccessory) room() string {
+	if remote.config.Room == "" {
+		return "undefined"
+	}
+	return remote.config.Room
+}
+
+func (remote *remoteAccessory) isEventCharacteristic(characteristic string) bool {
+	for _, event := range remote.config.Events {
+		if event == characteristic {
+			return true
+		}
+	}
+	return false
+}
+
+func (remote *remoteAccessory) isClosed() bool {
+	if remote.closed == nil {
+		return false
+	}
+	select {
+	case <-remote.closed:
+		return true
+	default:
+		return false
+	}
+}
+
+func (remote *remoteAccessory) close() {
+	if remote.client != nil {
+		remote.client.close()
+		remote.client = nil
+		remote.closed = nil
+	}
+}
+
+func isRemoteCharacteristic(name string) bool {
+	for _, remoteCharacteristic := range remoteCharacteristics {
+		if remoteCharacteristic.characteristic == name {
+			return true
+		}
+	}
+	return false
+}
+
+func hasPermission(perms []string, permission string) bool {
+	for _, perm := range perms {
+		if perm == permission {
+			return true
+		}
+	}
+	return false
+}
+
+func processRemoteCelsius(plugin *HomeKit, value interface{}) (string, map[string]interface{}, error) {
+	celsius, ok := value.(float64)
+	if !ok {
+		return "", nil, fmt.Errorf("unexpected value type %T", value)
+	}
+	return plugin.processCelsius(celsius)
+}
+
+func processRemoteLux(plugin *HomeKit, value interface{}) (string, map[string]interface{}, error) {
+	lux, ok := value.(float64)
+	if !ok {
+		return "", nil, fmt.Errorf("unexpected value type %T", value)
+	}
+	return plugin.processLux(lux)
+}
+
+func processRemoteHue(plugin *HomeKit, value interface{}) (string, map[string]interface{}, error) {
+	hue, ok := value.(float64)
+	if !ok {
+		return "", nil, fmt.Errorf("unexpected value type %T", value)
+	}
+	return plugin.processHue(int(hue))
+}
+
+func processRemoteState(plugin *HomeKit, value interface{}) (string, map[string]interface{}, error) {
+	switch state := value.(type) {
+	case bool:
+		return plugin.processStateValue(state)
+	case float64:
+		return plugin.processStateValue(state != 0)
+	}
+	return "", nil, fmt.Errorf("unexpected value type %T", value)
+}
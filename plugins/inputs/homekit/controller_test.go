@@ -0,0 +1,257 @@
+// controller_test.go
+//
+// # Copyright (C) 2023-2024 Holger de Carne
+//
+// This software may be modified and distributed under the terms
+// of the MIT license.  See the LICENSE file for details.
+package homekit
+
+import (
+	"bufio"
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"errors"
+	"net"
+	"net/http"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/brutella/hap"
+	"github.com/brutella/hap/accessory"
+	"github.com/brutella/hap/service"
+	"github.com/influxdata/telegraf/testutil"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPollRemoteAccessories(t *testing.T) {
+	remoteAddress := startRemoteAccessory(t, newRemoteThermometer())
+	storePath := filepath.Join(t.TempDir(), ".hap")
+
+	// The first run pairs the accessory, the second one re-uses the stored pairing
+	for run := 0; run < 2; run++ {
+		plugin := NewHomeKit()
+		plugin.Address = freeAddress(t)
+		plugin.HAPStorePath = storePath
+		plugin.MonitorAccessoryName = "TestMonitor"
+		plugin.Accessories = []AccessoryConfig{{Name: "TestAccessory", Address: remoteAddress, Pin: "031-45-154", Room: "Room"}}
+		plugin.Log = createDummyLogger()
+		require.NoError(t, plugin.Init())
+
+		acc := &testutil.Accumulator{}
+
+		require.NoError(t, plugin.Start(acc))
+		require.NoError(t, plugin.Gather(acc))
+		waitForMeasurement(t, acc, "homekit_temperature")
+		require.Empty(t, acc.Errors)
+		acc.AssertContainsTaggedFields(t, "homekit_temperature",
+			map[string]interface{}{
+				"celsius":    21.5,
+				"fahrenheit": 70.7},
+			map[string]string{
+				"homekit_monitor":        "TestMonitor",
+				"homekit_name":           "Thermometer",
+				"homekit_room":           "Room",
+				"homekit_characteristic": "Temperature"})
+		require.NotNil(t, loadAccessoryPairing(plugin.store, "TestAccessory"))
+		plugin.Stop()
+	}
+}
+
+func TestPollRemoteAccessoryFailure(t *testing.T) {
+	remoteAddress := startRemoteAccessory(t, newRemoteThermometer())
+
+	plugin := NewHomeKit()
+	plugin.Address = freeAddress(t)
+	plugin.HAPStorePath = filepath.Join(t.TempDir(), ".hap")
+	plugin.MonitorAccessoryName = "TestMonitor"
+	plugin.Accessories = []AccessoryConfig{{Name: "TestAccessory", Address: remoteAddress, Pin: "031-45-155"}}
+	plugin.Log = createDummyLogger()
+	require.NoError(t, plugin.Init())
+
+	acc := &testutil.Accumulator{}
+
+	defer plugin.Stop()
+	require.NoError(t, plugin.Start(acc))
+	require.NoError(t, plugin.Gather(acc))
+	acc.WaitError(1)
+	require.Len(t, acc.Errors, 1)
+	require.Nil(t, loadAccessoryPairing(plugin.store, "TestAccessory"))
+}
+
+func TestPollRemoteAccessoryStalePairing(t *testing.T) {
+	remoteAddress := startRemoteAccessory(t, newRemoteThermometer())
+
+	plugin := NewHomeKit()
+	plugin.Address = freeAddress(t)
+	plugin.HAPStorePath = filepath.Join(t.TempDir(), ".hap")
+	plugin.MonitorAccessoryName = "TestMonitor"
+	plugin.Accessories = []AccessoryConfig{{Name: "TestAccessory", Address: remoteAddress, Pin: "031-45-154"}}
+	plugin.Log = createDummyLogger()
+	require.NoError(t, plugin.Init())
+
+	// A pairing left over from before the accessory has been reset
+	store, err := plugin.openStore(true)
+	require.NoError(t, err)
+	publicKey, _, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	stale := &accessoryPairing{ID: "00:11:22:33:44:55", PublicKey: publicKey, Address: remoteAddress}
+	require.NoError(t, saveAccessoryPairing(store, "TestAccessory", stale))
+
+	acc := &testutil.Accumulator{}
+
+	defer plugin.Stop()
+	require.NoError(t, plugin.Start(acc))
+	require.NoError(t, plugin.Gather(acc))
+	acc.WaitError(1)
+	require.ErrorIs(t, acc.Errors[0], errPairingRejected)
+	require.Nil(t, loadAccessoryPairing(plugin.store, "TestAccessory"))
+
+	// The accessory may still be busy with the rejected session; keep polling until it is paired again
+	require.Eventually(t, func() bool {
+		require.NoError(t, plugin.Gather(acc))
+		return acc.HasMeasurement("homekit_temperature")
+	}, 5*time.Second, 100*time.Millisecond)
+	pairing := loadAccessoryPairing(plugin.store, "TestAccessory")
+	require.NotNil(t, pairing)
+	require.NotEqual(t, stale.ID, pairing.ID)
+}
+
+func TestPairVerifyRejected(t *testing.T) {
+	err := checkPairingRejected(&hapPairResponse{State: hap.M4, Error: hap.TlvErrorAuthentication}, errors.New("error"))
+	require.ErrorIs(t, err, errPairingRejected)
+	err = checkPairingRejected(&hapPairResponse{State: hap.M4, Error: hap.TlvErrorBusy}, errors.New("error"))
+	require.NotErrorIs(t, err, errPairingRejected)
+}
+
+func TestRemoteAccessoryEvents(t *testing.T) {
+	motionSensor := accessory.New(accessory.Info{Name: "Motion"}, accessory.TypeSensor)
+	motion := service.NewMotionSensor()
+	motionSensor.AddS(motion.S)
+	remoteAddress := startRemoteAccessory(t, motionSensor)
+
+	plugin := NewHomeKit()
+	plugin.Address = freeAddress(t)
+	plugin.HAPStorePath = filepath.Join(t.TempDir(), ".hap")
+	plugin.MonitorAccessoryName = "TestMonitor"
+	plugin.Accessories = []AccessoryConfig{{Name: "TestAccessory", Address: remoteAddress, Pin: "031-45-154", Events: []string{"Motion"}}}
+	plugin.Log = createDummyLogger()
+	require.NoError(t, plugin.Init())
+
+	acc := &testutil.Accumulator{}
+
+	defer plugin.Stop()
+	require.NoError(t, plugin.Start(acc))
+	require.NoError(t, plugin.Gather(acc))
+	waitForMeasurement(t, acc, "homekit_state")
+	require.Empty(t, acc.Errors)
+	acc.ClearMetrics()
+
+	// Events are pushed without polling, also after a reconnect
+	for run := 0; run < 2; run++ {
+		motion.MotionDetected.SetValue(true)
+		require.Eventually(t, func() bool {
+			return acc.HasPoint("homekit_state",
+				map[string]string{
+					"homekit_monitor":        "TestMonitor",
+					"homekit_name":           "Motion",
+					"homekit_room":           "undefined",
+					"homekit_characteristic": "Motion"},
+				"active", 1)
+		}, time.Second, 10*time.Millisecond)
+		motion.MotionDetected.SetValue(false)
+		acc.ClearMetrics()
+
+		remote := plugin.remoteAccessories[0]
+		remote.mutex.Lock()
+		remote.client.conn.Close()
+		remote.mutex.Unlock()
+		require.Eventually(t, remote.isClosed, time.Second, 10*time.Millisecond)
+		require.NoError(t, plugin.Gather(acc))
+		waitForMeasurement(t, acc, "homekit_state")
+		require.Empty(t, acc.Errors)
+		acc.ClearMetrics()
+	}
+}
+
+func TestRemoteAccessoryTimeout(t *testing.T) {
+	listener, err := net.Listen("tcp", "localhost:0")
+	require.NoError(t, err)
+	defer listener.Close()
+	responses := make(chan string, 1)
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		reader := bufio.NewReader(conn)
+		for {
+			req, err := http.ReadRequest(reader)
+			if err != nil {
+				return
+			}
+			req.Body.Close()
+			// the first response is delayed beyond the client timeout
+			conn.Write([]byte(<-responses))
+		}
+	}()
+
+	client, err := dialHAP(context.Background(), listener.Addr().String(), 100*time.Millisecond)
+	require.NoError(t, err)
+	defer client.close()
+	receiving, err := client.receiveEvents(func(*hapCharacteristics) {})
+	require.NoError(t, err)
+	_, err = client.getAccessories()
+	require.ErrorContains(t, err, "timed out")
+	responses <- "HTTP/1.1 200 OK\r\nContent-Length: 15\r\n\r\n{\"accessories\":1}"
+	// the late response must not be handed to the next request
+	require.Eventually(t, func() bool {
+		select {
+		case <-receiving:
+			return true
+		default:
+			return false
+		}
+	}, time.Second, 10*time.Millisecond)
+	_, err = client.getAccessories()
+	require.Error(t, err)
+}
+
+func TestHAPShortType(t *testing.T) {
+	require.Equal(t, "11", hapShortType("00000011-0000-1000-8000-0026BB765291"))
+	require.Equal(t, "3E", hapShortType("0000003e-0000-1000-8000-0026bb765291"))
+	require.Equal(t, "6B", hapShortType("6B"))
+}
+
+func newRemoteThermometer() *accessory.A {
+	thermometer := accessory.NewTemperatureSensor(accessory.Info{Name: "Thermometer"})
+	thermometer.TempSensor.CurrentTemperature.SetValue(21.5)
+	return thermometer.A
+}
+
+func waitForMeasurement(t *testing.T, acc *testutil.Accumulator, measurement string) {
+	require.Eventually(t, func() bool {
+		return acc.HasMeasurement(measurement)
+	}, 5*time.Second, 10*time.Millisecond)
+}
+
+func startRemoteAccessory(t *testing.T, a *accessory.A) string {
+	server, err := hap.NewServer(hap.NewMemStore(), a)
+	require.NoError(t, err)
+	server.Addr = freeAddress(t)
+	server.Pin = "03145154"
+	ctx, cancel := context.WithCancel(context.Background())
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		_ = server.ListenAndServe(ctx)
+	}()
+	t.Cleanup(func() {
+		cancel()
+		<-stopped
+	})
+	waitForAddress(t, server.Addr)
+	return server.Addr
+}
@@ -0,0 +1,293 @@
+// cryptstore.go
+//
+// Copyright (C) 2023-2024 Holger de Carne
+//
+// This software may be modified and distributed under the terms
+// of the MIT license.  See the LICENSE file for details.
+
+package homekit
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/brutella/hap"
+	"golang.org/x/crypto/scrypt"
+)
+
+const (
+	storeEncryptionNone   = "none"
+	storeEncryptionEnv    = "env"
+	storeEncryptionFile   = "file"
+	storeEncryptionSecret = "secret"
+)
+
+var storeEncryptions = map[string]bool{
+	storeEncryptionNone:   true,
+	storeEncryptionEnv:    true,
+	storeEncryptionFile:   true,
+	storeEncryptionSecret: true,
+}
+
+const (
+	storeEncryptionKDF    = "scrypt"
+	storeEncryptionCipher = "aes-256-gcm"
+	storeEncryptionN      = 32768
+	storeEncryptionR      = 8
+	storeEncryptionP      = 1
+	storeEncryptionKeyLen = 32
+)
+
+// The store entry holding the encryption parameters of an encrypted HAP store
+const encryptionKey = "encryption"
+
+// The value sealed into the encryption entry to verify the key on open
+var encryptionCheck = []byte("homekit-telegraf-plugin")
+
+type storeEncryption struct {
+	KDF    string `json:"kdf"`
+	N      int    `json:"n"`
+	R      int    `json:"r"`
+	P      int    `json:"p"`
+	Salt   []byte `json:"salt"`
+	Cipher string `json:"cipher"`
+	Nonce  []byte `json:"nonce"`
+	Check  []byte `json:"check,omitempty"`
+}
+
+func newStoreEncryption() (*storeEncryption, error) {
+	encryption := &storeEncryption{
+		KDF:    storeEncryptionKDF,
+		N:      storeEncryptionN,
+		R:      storeEncryptionR,
+		P:      storeEncryptionP,
+		Salt:   make([]byte, 16),
+		Cipher: storeEncryptionCipher,
+		Nonce:  make([]byte, 12),
+	}
+	_, err := rand.Read(encryption.Salt)
+	if err != nil {
+		return nil, err
+	}
+	_, err = rand.Read(encryption.Nonce)
+	if err != nil {
+		return nil, err
+	}
+	return encryption, nil
+}
+
+// aead derives the encryption key from the given key material.
+func (encryption *storeEncryption) aead(keyMaterial []byte) (cipher.AEAD, error) {
+	if encryption.KDF != storeEncryptionKDF || encryption.Cipher != storeEncryptionCipher {
+		return nil, fmt.Errorf("unsupported encryption %s/%s", encryption.KDF, encryption.Cipher)
+	}
+	key, err := scrypt.Key(keyMaterial, encryption.Salt, encryption.N, encryption.R, encryption.P, storeEncryptionKeyLen)
+	if err != nil {
+		return nil, err
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// encryptedStore encrypts the entries of the wrapped HAP store. Every entry is sealed with its own nonce and
+// bound to its key.
+type encryptedStore struct {
+	store hap.Store
+	aead  cipher.AEAD
+}
+
+// readStoreEncryption reads the encryption parameters of the given HAP store (nil if the HAP store is not
+// encrypted).
+func readStoreEncryption(store hap.Store) (*storeEncryption, error) {
+	encryptionBytes, err := store.Get(encryptionKey)
+	if isNoStoreEntry(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("failed to read HAP store encryption entry (cause: %v)", err)
+	}
+	var encryption storeEncryption
+	err = json.Unmarshal(encryptionBytes, &encryption)
+	if err != nil {
+		return nil, fmt.Errorf("invalid HAP store encryption entry (cause: %v)", err)
+	}
+	return &encryption, nil
+}
+
+// openEncryptedStore opens the given HAP store for encryption using the given key material. An empty HAP store is
+// set up for encryption. Unencrypted entries have to be migrated beforehand (see encryptStore).
+func openEncryptedStore(store hap.Store, keyMaterial []byte) (*encryptedStore, error) {
+	encryption, err := readStoreEncryption(store)
+	if err != nil {
+		return nil, err
+	}
+	if encryption != nil {
+		aead, err := encryption.aead(keyMaterial)
+		if err != nil {
+			return nil, err
+		}
+		_, err = aead.Open(nil, encryption.Nonce, encryption.Check, []byte(encryptionKey))
+		if err != nil {
+			return nil, errors.New("failed to decrypt HAP store (wrong key?)")
+		}
+		return &encryptedStore{store: store, aead: aead}, nil
+	}
+	keys, err := store.KeysWithSuffix("")
+	if err != nil {
+		return nil, err
+	}
+	if len(keys) > 0 {
+		return nil, errors.New("HAP store contains unencrypted entries")
+	}
+	encryption, err = newStoreEncryption()
+	if err != nil {
+		return nil, err
+	}
+	aead, err := encryption.aead(keyMaterial)
+	if err != nil {
+		return nil, err
+	}
+	encryption.Check = aead.Seal(nil, encryption.Nonce, encryptionCheck, []byte(encryptionKey))
+	encryptionBytes, err := json.Marshal(encryption)
+	if err != nil {
+		return nil, err
+	}
+	err = store.Set(encryptionKey, encryptionBytes)
+	if err != nil {
+		return nil, err
+	}
+	return &encryptedStore{store: store, aead: aead}, nil
+}
+
+func (store *encryptedStore) Set(key string, value []byte) error {
+	nonce := make([]byte, store.aead.NonceSize())
+	_, err := rand.Read(nonce)
+	if err != nil {
+		return err
+	}
+	return store.store.Set(key, store.aead.Seal(nonce, nonce, value, []byte(key)))
+}
+
+func (store *encryptedStore) Get(key string) ([]byte, error) {
+	sealed, err := store.store.Get(key)
+	if err != nil {
+		return nil, err
+	}
+	nonceSize := store.aead.NonceSize()
+	if len(sealed) < nonceSize {
+		return nil, fmt.Errorf("invalid encrypted HAP store entry '%s'", key)
+	}
+	value, err := store.aead.Open(nil, sealed[:nonceSize], sealed[nonceSize:], []byte(key))
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt HAP store entry '%s' (cause: %v)", key, err)
+	}
+	return value, nil
+}
+
+func (store *encryptedStore) Delete(key string) error {
+	return store.store.Delete(key)
+}
+
+func (store *encryptedStore) Close() error {
+	return CloseHAPStore(store.store)
+}
+
+func (store *encryptedStore) KeysWithSuffix(suffix string) ([]string, error) {
+	keys, err := store.store.KeysWithSuffix(suffix)
+	if err != nil {
+		return nil, err
+	}
+	filtered := make([]string, 0, len(keys))
+	for _, key := range keys {
+		if key != encryptionKey {
+			filtered = append(filtered, key)
+		}
+	}
+	return filtered, nil
+}
+
+// storeKeyMaterial reads the HAP store key from the configured source.
+func (plugin *HomeKit) storeKeyMaterial() ([]byte, error) {
+	switch plugin.HAPStoreEncryption {
+	case storeEncryptionEnv:
+		keyMaterial := os.Getenv(plugin.HAPStoreKeyEnv)
+		if keyMaterial == "" {
+			return nil, fmt.Errorf("HAP store key environment variable %s is not set", plugin.HAPStoreKeyEnv)
+		}
+		return []byte(keyMaterial), nil
+	case storeEncryptionFile:
+		keyMaterial, err := os.ReadFile(plugin.HAPStoreKeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read HAP store key file %s (cause: %v)", plugin.HAPStoreKeyFile, err)
+		}
+		keyMaterial = []byte(strings.TrimRight(string(keyMaterial), "\r\n"))
+		if len(keyMaterial) == 0 {
+			return nil, fmt.Errorf("HAP store key file %s is empty", plugin.HAPStoreKeyFile)
+		}
+		return keyMaterial, nil
+	case storeEncryptionSecret:
+		secret, err := plugin.HAPStoreKey.Get()
+		if err != nil {
+			return nil, fmt.Errorf("failed to get HAP store key (cause: %v)", err)
+		}
+		defer secret.Destroy()
+		return append([]byte(nil), secret.Bytes()...), nil
+	}
+	return nil, nil
+}
+
+func (plugin *HomeKit) isStoreEncryptionEnabled() bool {
+	return plugin.HAPStoreEncryption != "" && plugin.HAPStoreEncryption != storeEncryptionNone
+}
+
+// encryptStore migrates the given HAP store if it is unencrypted but encryption is enabled. The entries are
+// written to a new encrypted HAP store, which replaces the unencrypted one once it is complete. Hence an
+// interrupted migration leaves the unencrypted HAP store untouched. The given HAP store is closed on migration
+// and the HAP store to use is returned.
+func (plugin *HomeKit) encryptStore(store hap.Store) (hap.Store, error) {
+	if !plugin.isStoreEncryptionEnabled() {
+		return store, nil
+	}
+	encryption, err := readStoreEncryption(store)
+	if err != nil || encryption != nil {
+		return store, err
+	}
+	entries, err := storeEntries(store)
+	if err != nil || len(entries) == 0 {
+		return store, err
+	}
+	CloseHAPStore(store)
+	err = plugin.replaceStore(entries)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encrypt HAP store %s (cause: %v)", plugin.HAPStorePath, err)
+	}
+	plugin.Log.Infof("Encrypted %d existing HAP store entries: %s", len(entries), plugin.HAPStorePath)
+	return OpenHAPStore(plugin.HAPStoreType, plugin.HAPStorePath)
+}
+
+// wrapStore applies the configured HAP store encryption to the given HAP store.
+func (plugin *HomeKit) wrapStore(store hap.Store) (hap.Store, error) {
+	if !plugin.isStoreEncryptionEnabled() {
+		encryption, err := readStoreEncryption(store)
+		if err != nil {
+			return nil, err
+		}
+		if encryption != nil {
+			return nil, fmt.Errorf("HAP store %s is encrypted; set hap_store_encryption to access it", plugin.HAPStorePath)
+		}
+		return store, nil
+	}
+	keyMaterial, err := plugin.storeKeyMaterial()
+	if err != nil {
+		return nil, err
+	}
+	return openEncryptedStore(store, keyMaterial)
+}
@@ -0,0 +1,141 @@
+// cryptstore_test.go
+//
+// # Copyright (C) 2023-2024 Holger de Carne
+//
+// This software may be modified and distributed under the terms
+// of the MIT license.  See the LICENSE file for details.
+package homekit
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/brutella/hap"
+	"github.com/influxdata/telegraf/config"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEncryptedStore(t *testing.T) {
+	plugin := NewHomeKit()
+	plugin.Address = freeAddress(t)
+	plugin.HAPStorePath = filepath.Join(t.TempDir(), ".hap")
+	plugin.Log = createDummyLogger()
+
+	// create a plain store and migrate it
+	plainStore, err := plugin.openStore(true)
+	require.NoError(t, err)
+	require.NoError(t, plainStore.Set(uuidKey, []byte("00:11:22:33:44:55")))
+	savePairing(t, plainStore, hap.Pairing{Name: "Controller1", Permission: hap.PermissionAdmin})
+
+	t.Setenv("TEST_HAP_STORE_KEY", "secret")
+	plugin.HAPStoreEncryption = "env"
+	plugin.HAPStoreKeyEnv = "TEST_HAP_STORE_KEY"
+	store, err := plugin.openStore(true)
+	require.NoError(t, err)
+	uuidBytes, err := os.ReadFile(filepath.Join(plugin.HAPStorePath, uuidKey))
+	require.NoError(t, err)
+	require.NotContains(t, string(uuidBytes), "00:11:22:33:44:55")
+	deviceID, err := store.Get(uuidKey)
+	require.NoError(t, err)
+	require.Equal(t, "00:11:22:33:44:55", string(deviceID))
+	keys, err := store.KeysWithSuffix("")
+	require.NoError(t, err)
+	require.Len(t, keys, 2)
+	info, err := plugin.StoreInfo()
+	require.NoError(t, err)
+	require.Equal(t, "00:11:22:33:44:55", info.DeviceID)
+	require.Len(t, info.Pairings, 1)
+
+	// the same key from a different source
+	keyFile := filepath.Join(t.TempDir(), "key")
+	require.NoError(t, os.WriteFile(keyFile, []byte("secret\n"), 0600))
+	plugin.HAPStoreEncryption = "file"
+	plugin.HAPStoreKeyFile = keyFile
+	_, err = plugin.StoreInfo()
+	require.NoError(t, err)
+	plugin.HAPStoreEncryption = "secret"
+	plugin.HAPStoreKey = config.NewSecret([]byte("secret"))
+	_, err = plugin.StoreInfo()
+	require.NoError(t, err)
+
+	// a wrong key or no key
+	plugin.HAPStoreKey = config.NewSecret([]byte("wrong"))
+	_, err = plugin.StoreInfo()
+	require.Error(t, err)
+	plugin.HAPStoreEncryption = "none"
+	_, err = plugin.StoreInfo()
+	require.Error(t, err)
+	plugin.HAPStoreEncryption = "env"
+	plugin.HAPStoreKeyEnv = "TEST_HAP_STORE_KEY_UNSET"
+	_, err = plugin.StoreInfo()
+	require.Error(t, err)
+}
+
+func TestEncryptedStoreMigrationOnStartOnly(t *testing.T) {
+	plugin := NewHomeKit()
+	plugin.Address = freeAddress(t)
+	plugin.HAPStorePath = filepath.Join(t.TempDir(), ".hap")
+	plugin.Log = createDummyLogger()
+
+	plainStore, err := plugin.openStore(true)
+	require.NoError(t, err)
+	require.NoError(t, plainStore.Set(uuidKey, []byte("00:11:22:33:44:55")))
+
+	// read-only access leaves the plain store untouched
+	t.Setenv("TEST_HAP_STORE_KEY", "secret")
+	plugin.HAPStoreEncryption = "env"
+	plugin.HAPStoreKeyEnv = "TEST_HAP_STORE_KEY"
+	info, err := plugin.StoreInfo()
+	require.NoError(t, err)
+	require.Equal(t, "00:11:22:33:44:55", info.DeviceID)
+	var archive bytes.Buffer
+	_, err = plugin.ExportStore(&archive, "")
+	require.NoError(t, err)
+	uuidBytes, err := os.ReadFile(filepath.Join(plugin.HAPStorePath, uuidKey))
+	require.NoError(t, err)
+	require.Equal(t, "00:11:22:33:44:55", string(uuidBytes))
+	require.NoFileExists(t, filepath.Join(plugin.HAPStorePath, encryptionKey))
+}
+
+func TestEncryptedStoreMigrationFailure(t *testing.T) {
+	plugin := NewHomeKit()
+	plugin.Address = freeAddress(t)
+	plugin.HAPStorePath = filepath.Join(t.TempDir(), ".hap")
+	plugin.Log = createDummyLogger()
+	plainStore, err := plugin.openStore(true)
+	require.NoError(t, err)
+	require.NoError(t, plainStore.Set(uuidKey, []byte("00:11:22:33:44:55")))
+
+	// the key is only read while writing the new encrypted store
+	plugin.HAPStoreEncryption = "env"
+	plugin.HAPStoreKeyEnv = "TEST_HAP_STORE_KEY_UNSET"
+	_, err = plugin.openStore(true)
+	require.Error(t, err)
+	_, err = os.Stat(plugin.HAPStorePath + storeNewSuffix)
+	require.ErrorIs(t, err, os.ErrNotExist)
+
+	plugin.HAPStoreEncryption = "none"
+	info, err := plugin.StoreInfo()
+	require.NoError(t, err)
+	require.Equal(t, "00:11:22:33:44:55", info.DeviceID)
+}
+
+type failingStore struct {
+	hap.Store
+}
+
+func (store *failingStore) Get(key string) ([]byte, error) {
+	return nil, errors.New("I/O error")
+}
+
+func TestStoreEncryptionReadFailure(t *testing.T) {
+	plugin := NewHomeKit()
+	plugin.Log = createDummyLogger()
+	_, err := plugin.wrapStore(&failingStore{})
+	require.Error(t, err)
+	_, err = openEncryptedStore(&failingStore{}, []byte("secret"))
+	require.Error(t, err)
+}
@@ -0,0 +1,145 @@
+// decode.go
+//
+// Copyright (C) 2023-2024 Holger de Carne
+//
+// This software may be modified and distributed under the terms
+// of the MIT license.  See the LICENSE file for details.
+
+package homekit
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/influxdata/telegraf/plugins/parsers/influx"
+)
+
+const (
+	mediaTypeJSON         = "application/json"
+	mediaTypeForm         = "application/x-www-form-urlencoded"
+	mediaTypeLineProtocol = "text/plain"
+	mediaTypeCSV          = "text/csv"
+)
+
+const lineProtocolValueField = "value"
+const lineProtocolUnitTag = "unit"
+
+var errUnsupportedContentType = errors.New("unsupported content type")
+
+func decodeData(contentType string, body []byte) (map[string]string, error) {
+	mediaType, params, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s (cause: %v)", errUnsupportedContentType, contentType, err)
+	}
+	charset, ok := params["charset"]
+	if ok && !strings.EqualFold(charset, "utf-8") && !strings.EqualFold(charset, "us-ascii") {
+		return nil, fmt.Errorf("%w: %s (unsupported charset)", errUnsupportedContentType, contentType)
+	}
+	switch mediaType {
+	case mediaTypeJSON:
+		return decodeJSONData(body)
+	case mediaTypeForm:
+		return decodeFormData(body)
+	case mediaTypeLineProtocol:
+		return decodeLineProtocolData(body)
+	case mediaTypeCSV:
+		return decodeCSVData(body)
+	}
+	return nil, fmt.Errorf("%w: %s", errUnsupportedContentType, contentType)
+}
+
+func decodeJSONData(body []byte) (map[string]string, error) {
+	var data map[string]string
+	err := json.Unmarshal(body, &data)
+	if err != nil {
+		return nil, err
+	}
+	return data, nil
+}
+
+func decodeFormData(body []byte) (map[string]string, error) {
+	values, err := url.ParseQuery(string(body))
+	if err != nil {
+		return nil, err
+	}
+	data := make(map[string]string)
+	for key, value := range values {
+		if len(value) > 0 {
+			data[key] = value[0]
+		}
+	}
+	return data, nil
+}
+
+func decodeLineProtocolData(body []byte) (map[string]string, error) {
+	parser := &influx.Parser{}
+	err := parser.Init()
+	if err != nil {
+		return nil, err
+	}
+	metrics, err := parser.Parse(body)
+	if err != nil {
+		return nil, err
+	}
+	data := make(map[string]string)
+	for _, metric := range metrics {
+		value, ok := metric.GetField(lineProtocolValueField)
+		if !ok {
+			return nil, fmt.Errorf("missing field '%s' for line: %s", lineProtocolValueField, metric.Name())
+		}
+		data[metric.Name()], err = lineProtocolValue(metric.Name(), value, metric.Tags())
+		if err != nil {
+			return nil, err
+		}
+	}
+	return data, nil
+}
+
+// lineProtocolValue converts a line protocol value field to a reading value. String values are taken as is.
+// Numeric values are combined with the line's unit tag (e.g. value=21.5 with unit=°C becomes "21.5 °C"), so
+// they are recognized via the configured suffixes like string values.
+func lineProtocolValue(name string, value interface{}, tags map[string]string) (string, error) {
+	var number string
+	switch typedValue := value.(type) {
+	case string:
+		return typedValue, nil
+	case float64:
+		number = strconv.FormatFloat(typedValue, 'f', -1, 64)
+	case int64:
+		number = strconv.FormatInt(typedValue, 10)
+	case uint64:
+		number = strconv.FormatUint(typedValue, 10)
+	default:
+		return "", fmt.Errorf("unsupported field '%s' type %T for line: %s", lineProtocolValueField, value, name)
+	}
+	unit, ok := tags[lineProtocolUnitTag]
+	if !ok {
+		return "", fmt.Errorf("missing tag '%s' for numeric field '%s' for line: %s", lineProtocolUnitTag, lineProtocolValueField, name)
+	}
+	return number + " " + unit, nil
+}
+
+func decodeCSVData(body []byte) (map[string]string, error) {
+	reader := csv.NewReader(bytes.NewReader(body))
+	reader.FieldsPerRecord = 2
+	reader.TrimLeadingSpace = true
+	data := make(map[string]string)
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, err
+		}
+		data[record[0]] = record[1]
+	}
+	return data, nil
+}
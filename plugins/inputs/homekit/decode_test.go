@@ -0,0 +1,73 @@
+// decode_test.go
+//
+// # Copyright (C) 2023-2024 Holger de Carne
+//
+// This software may be modified and distributed under the terms
+// of the MIT license.  See the LICENSE file for details.
+package homekit
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestDecodeData(t *testing.T) {
+	expected := map[string]string{
+		"Name_Room":       "12,3 °C",
+		"Name_Room_Light": "Yes"}
+	bodies := map[string]string{
+		"application/json":                                 `{"Name_Room": "12,3 °C", "Name_Room_Light": "Yes"}`,
+		"application/json; charset=utf-8":                  `{"Name_Room": "12,3 °C", "Name_Room_Light": "Yes"}`,
+		"application/x-www-form-urlencoded":                "Name_Room=12%2C3+%C2%B0C&Name_Room_Light=Yes",
+		"application/x-www-form-urlencoded; charset=UTF-8": "Name_Room=12%2C3+%C2%B0C&Name_Room_Light=Yes",
+		"text/plain": "Name_Room value=\"12,3 °C\"\nName_Room_Light value=\"Yes\"\n",
+		"text/csv":   "Name_Room,\"12,3 °C\"\nName_Room_Light, Yes\n",
+	}
+	for contentType, body := range bodies {
+		data, err := decodeData(contentType, []byte(body))
+		require.NoError(t, err, contentType)
+		require.Equal(t, expected, data, contentType)
+	}
+}
+
+func TestDecodeLineProtocolNumbers(t *testing.T) {
+	data, err := decodeData("text/plain", []byte("Name_Room,unit=°C value=21.5\nName_Room_Light,unit=lx value=800i\nName_Room_Hue,unit=° value=120u\n"))
+	require.NoError(t, err)
+	require.Equal(t, map[string]string{
+		"Name_Room":       "21.5 °C",
+		"Name_Room_Light": "800 lx",
+		"Name_Room_Hue":   "120 °"}, data)
+
+	plugin := NewHomeKit()
+	plugin.Log = createDummyLogger()
+	require.NoError(t, plugin.Init())
+	measurement, fields, err := plugin.processDataValue(data["Name_Room"])
+	require.NoError(t, err)
+	require.Equal(t, "homekit_temperature", measurement)
+	require.Equal(t, 21.5, fields["celsius"])
+	measurement, fields, err = plugin.processDataValue(data["Name_Room_Light"])
+	require.NoError(t, err)
+	require.Equal(t, "homekit_light_level", measurement)
+	require.Equal(t, 800.0, fields["lux"])
+}
+
+func TestDecodeDataFailures(t *testing.T) {
+	_, err := decodeData("application/xml", []byte("<xml></xml>"))
+	require.ErrorIs(t, err, errUnsupportedContentType)
+	_, err = decodeData("application/json; charset=iso-8859-1", []byte("{}"))
+	require.ErrorIs(t, err, errUnsupportedContentType)
+	_, err = decodeData("", []byte("{}"))
+	require.ErrorIs(t, err, errUnsupportedContentType)
+	_, err = decodeData("application/json", []byte("<xml></xml>"))
+	require.Error(t, err)
+	require.NotErrorIs(t, err, errUnsupportedContentType)
+	_, err = decodeData("text/plain", []byte("Name_Room other=\"Yes\""))
+	require.Error(t, err)
+	_, err = decodeData("text/plain", []byte("Name_Room value=21.5"))
+	require.Error(t, err)
+	_, err = decodeData("text/plain", []byte("Name_Room value=true"))
+	require.Error(t, err)
+	_, err = decodeData("text/csv", []byte("Name_Room,Yes,No"))
+	require.Error(t, err)
+}
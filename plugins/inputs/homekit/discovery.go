@@ -0,0 +1,253 @@
+// discovery.go
+//
+// Copyright (C) 2023-2024 Holger de Carne
+//
+// This software may be modified and distributed under the terms
+// of the MIT license.  See the LICENSE file for details.
+
+package homekit
+
+import (
+	"context"
+	"net"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/brutella/dnssd"
+	"github.com/influxdata/telegraf"
+)
+
+// The accessory categories as defined by the ci TXT record
+var discoveryCategories = map[int]string{
+	1:  "other",
+	2:  "bridge",
+	3:  "fan",
+	4:  "garage_door_opener",
+	5:  "lightbulb",
+	6:  "door_lock",
+	7:  "outlet",
+	8:  "switch",
+	9:  "thermostat",
+	10: "sensor",
+	11: "security_system",
+	12: "door",
+	13: "window",
+	14: "window_covering",
+	15: "programmable_switch",
+	16: "range_extender",
+	17: "ip_camera",
+	18: "video_doorbell",
+	19: "air_purifier",
+	20: "heater",
+	21: "air_conditioner",
+	22: "humidifier",
+	23: "dehumidifier",
+	28: "sprinkler",
+	29: "faucet",
+	30: "shower_system",
+	31: "television",
+	32: "remote_control",
+}
+
+// DiscoveredAccessory describes a HAP accessory advertised via DNS-SD.
+type DiscoveredAccessory struct {
+	Name            string
+	DeviceID        string
+	Model           string
+	Category        int
+	ConfigNumber    int
+	StateNumber     int
+	StatusFlags     int
+	FeatureFlags    int
+	ProtocolVersion string
+	Address         string
+	Online          bool
+	LastSeen        time.Time
+}
+
+func newDiscoveredAccessory(entry dnssd.BrowseEntry, seen time.Time) *DiscoveredAccessory {
+	host := entry.Host
+	if len(entry.IPs) > 0 {
+		host = entry.IPs[0].String()
+	}
+	return &DiscoveredAccessory{
+		Name:            entry.UnescapedName(),
+		DeviceID:        entry.Text["id"],
+		Model:           entry.Text["md"],
+		Category:        discoveryTextNumber(entry.Text["ci"]),
+		ConfigNumber:    discoveryTextNumber(entry.Text["c#"]),
+		StateNumber:     discoveryTextNumber(entry.Text["s#"]),
+		StatusFlags:     discoveryTextNumber(entry.Text["sf"]),
+		FeatureFlags:    discoveryTextNumber(entry.Text["ff"]),
+		ProtocolVersion: entry.Text["pv"],
+		Address:         net.JoinHostPort(host, strconv.Itoa(entry.Port)),
+		Online:          true,
+		LastSeen:        seen,
+	}
+}
+
+func discoveryTextNumber(text string) int {
+	number, err := strconv.Atoi(text)
+	if err != nil {
+		return 0
+	}
+	return number
+}
+
+// Paired reports whether the accessory is paired with a controller (status flag 0x01 cleared).
+func (discovered *DiscoveredAccessory) Paired() bool {
+	return discovered.StatusFlags&0x01 == 0
+}
+
+// CategoryName gets the name of the accessory's category.
+func (discovered *DiscoveredAccessory) CategoryName() string {
+	name, ok := discoveryCategories[discovered.Category]
+	if !ok {
+		return "unknown"
+	}
+	return name
+}
+
+func (discovered *DiscoveredAccessory) key() string {
+	if discovered.DeviceID != "" {
+		return discovered.DeviceID
+	}
+	return discovered.Name
+}
+
+// Discover looks up the HAP accessories advertised on the network until the given context is done.
+func Discover(ctx context.Context) ([]DiscoveredAccessory, error) {
+	inventory := newDiscoveryInventory()
+	err := inventory.lookup(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return inventory.list(), nil
+}
+
+type discoveryInventory struct {
+	accessories map[string]*DiscoveredAccessory
+	seen        map[string]bool
+	retention   time.Duration
+	mutex       sync.Mutex
+}
+
+func newDiscoveryInventory() *discoveryInventory {
+	return &discoveryInventory{
+		accessories: make(map[string]*DiscoveredAccessory),
+		seen:        make(map[string]bool),
+	}
+}
+
+// lookup runs a single lookup cycle. Accessories not seen during the cycle are flagged offline afterwards and
+// dropped as soon as they have not been seen for the retention period.
+func (inventory *discoveryInventory) lookup(ctx context.Context) error {
+	inventory.mutex.Lock()
+	inventory.seen = make(map[string]bool)
+	inventory.mutex.Unlock()
+	err := dnssd.LookupType(ctx, hapServiceType, inventory.add, inventory.remove)
+	if err != nil && ctx.Err() == nil {
+		return err
+	}
+	inventory.expire(time.Now())
+	return nil
+}
+
+func (inventory *discoveryInventory) add(entry dnssd.BrowseEntry) {
+	discovered := newDiscoveredAccessory(entry, time.Now())
+	inventory.mutex.Lock()
+	defer inventory.mutex.Unlock()
+	inventory.accessories[discovered.key()] = discovered
+	inventory.seen[discovered.key()] = true
+}
+
+func (inventory *discoveryInventory) remove(entry dnssd.BrowseEntry) {
+	key := newDiscoveredAccessory(entry, time.Now()).key()
+	inventory.mutex.Lock()
+	defer inventory.mutex.Unlock()
+	discovered, ok := inventory.accessories[key]
+	if ok {
+		discovered.Online = false
+	}
+	delete(inventory.seen, key)
+}
+
+func (inventory *discoveryInventory) expire(now time.Time) {
+	inventory.mutex.Lock()
+	defer inventory.mutex.Unlock()
+	for key, discovered := range inventory.accessories {
+		if inventory.seen[key] {
+			continue
+		}
+		discovered.Online = false
+		if inventory.retention > 0 && now.Sub(discovered.LastSeen) > inventory.retention {
+			delete(inventory.accessories, key)
+		}
+	}
+}
+
+func (inventory *discoveryInventory) list() []DiscoveredAccessory {
+	inventory.mutex.Lock()
+	accessories := make([]DiscoveredAccessory, 0, len(inventory.accessories))
+	for _, discovered := range inventory.accessories {
+		accessories = append(accessories, *discovered)
+	}
+	inventory.mutex.Unlock()
+	sort.Slice(accessories, func(i, j int) bool {
+		if accessories[i].Name != accessories[j].Name {
+			return accessories[i].Name < accessories[j].Name
+		}
+		return accessories[i].DeviceID < accessories[j].DeviceID
+	})
+	return accessories
+}
+
+func (plugin *HomeKit) startDiscovery(ctx context.Context) {
+	if !plugin.Discovery {
+		return
+	}
+	plugin.Log.Infof("Starting accessory discovery (interval: %s)", time.Duration(plugin.DiscoveryInterval))
+	plugin.discovery = newDiscoveryInventory()
+	plugin.discovery.retention = time.Duration(plugin.DiscoveryRetention)
+	plugin.serverStopped.Add(1)
+	go func() {
+		defer plugin.serverStopped.Done()
+		for ctx.Err() == nil {
+			cycleCtx, cancelCycle := context.WithTimeout(ctx, time.Duration(plugin.DiscoveryInterval))
+			err := plugin.discovery.lookup(cycleCtx)
+			if err != nil {
+				plugin.Log.Warnf("Failed to discover accessories (%v)", err)
+				<-cycleCtx.Done()
+			}
+			cancelCycle()
+		}
+	}()
+}
+
+func (plugin *HomeKit) gatherDiscovery(acc telegraf.Accumulator) {
+	if plugin.discovery == nil {
+		return
+	}
+	for _, discovered := range plugin.discovery.list() {
+		tags := make(map[string]string)
+		tags["homekit_monitor"] = plugin.MonitorAccessoryName
+		tags["homekit_name"] = discovered.Name
+		tags["homekit_device_id"] = discovered.DeviceID
+		tags["homekit_model"] = discovered.Model
+		tags["homekit_category"] = discovered.CategoryName()
+		fields := make(map[string]interface{})
+		fields["online"] = discovered.Online
+		fields["paired"] = discovered.Paired()
+		fields["category"] = discovered.Category
+		fields["config_number"] = discovered.ConfigNumber
+		fields["state_number"] = discovered.StateNumber
+		fields["status_flags"] = discovered.StatusFlags
+		fields["feature_flags"] = discovered.FeatureFlags
+		fields["protocol_version"] = discovered.ProtocolVersion
+		fields["address"] = discovered.Address
+		fields["last_seen"] = discovered.LastSeen.Unix()
+		acc.AddFields("homekit_discovery", fields, tags)
+	}
+}
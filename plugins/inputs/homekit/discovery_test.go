@@ -0,0 +1,122 @@
+// discovery_test.go
+//
+// # Copyright (C) 2023-2024 Holger de Carne
+//
+// This software may be modified and distributed under the terms
+// of the MIT license.  See the LICENSE file for details.
+package homekit
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/brutella/dnssd"
+	"github.com/influxdata/telegraf/testutil"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewDiscoveredAccessory(t *testing.T) {
+	seen := time.Now()
+	discovered := newDiscoveredAccessory(newDiscoveryEntry("Thermometer", "AA:BB:CC:DD:EE:01", "0"), seen)
+	require.Equal(t, "Thermometer", discovered.Name)
+	require.Equal(t, "AA:BB:CC:DD:EE:01", discovered.DeviceID)
+	require.Equal(t, "Sensor", discovered.Model)
+	require.Equal(t, "sensor", discovered.CategoryName())
+	require.Equal(t, 2, discovered.ConfigNumber)
+	require.Equal(t, 1, discovered.StateNumber)
+	require.Equal(t, "1.1", discovered.ProtocolVersion)
+	require.Equal(t, "192.168.1.10:51826", discovered.Address)
+	require.True(t, discovered.Paired())
+	require.True(t, discovered.Online)
+	require.Equal(t, seen, discovered.LastSeen)
+
+	discovered = newDiscoveredAccessory(dnssd.BrowseEntry{Name: "Unknown", Host: "unknown.local.", Port: 80, Text: map[string]string{"ci": "x", "sf": "1"}}, seen)
+	require.Equal(t, "unknown", discovered.CategoryName())
+	require.Equal(t, "unknown.local.:80", discovered.Address)
+	require.False(t, discovered.Paired())
+}
+
+func TestDiscoveryInventory(t *testing.T) {
+	inventory := newDiscoveryInventory()
+	thermometer := newDiscoveryEntry("Thermometer", "AA:BB:CC:DD:EE:01", "0")
+	motion := newDiscoveryEntry("Motion", "AA:BB:CC:DD:EE:02", "1")
+	inventory.add(thermometer)
+	inventory.add(motion)
+	accessories := inventory.list()
+	require.Len(t, accessories, 2)
+	require.Equal(t, "Motion", accessories[0].Name)
+	require.True(t, accessories[0].Online)
+	require.Equal(t, "Thermometer", accessories[1].Name)
+	require.True(t, accessories[1].Online)
+
+	// Removed accessories are kept but flagged offline
+	inventory.remove(motion)
+	accessories = inventory.list()
+	require.Len(t, accessories, 2)
+	require.False(t, accessories[0].Online)
+	require.True(t, accessories[1].Online)
+
+	// Accessories not seen during a lookup cycle are flagged offline
+	inventory.seen = make(map[string]bool)
+	inventory.add(motion)
+	inventory.expire(time.Now())
+	accessories = inventory.list()
+	require.True(t, accessories[0].Online)
+	require.False(t, accessories[1].Online)
+
+	// Accessories not seen for the retention period are dropped
+	inventory.retention = time.Hour
+	inventory.seen = make(map[string]bool)
+	inventory.add(motion)
+	inventory.expire(time.Now().Add(2 * time.Hour))
+	accessories = inventory.list()
+	require.Len(t, accessories, 1)
+	require.Equal(t, "Motion", accessories[0].Name)
+	require.True(t, accessories[0].Online)
+}
+
+func TestGatherDiscovery(t *testing.T) {
+	plugin := NewHomeKit()
+	plugin.MonitorAccessoryName = "TestMonitor"
+	plugin.discovery = newDiscoveryInventory()
+	plugin.discovery.add(newDiscoveryEntry("Thermometer", "AA:BB:CC:DD:EE:01", "0"))
+
+	acc := &testutil.Accumulator{}
+
+	plugin.gatherDiscovery(acc)
+	require.Len(t, acc.Metrics, 1)
+	require.Equal(t, "homekit_discovery", acc.Metrics[0].Measurement)
+	require.Equal(t, map[string]string{
+		"homekit_monitor":   "TestMonitor",
+		"homekit_name":      "Thermometer",
+		"homekit_device_id": "AA:BB:CC:DD:EE:01",
+		"homekit_model":     "Sensor",
+		"homekit_category":  "sensor"}, acc.Metrics[0].Tags)
+	fields := acc.Metrics[0].Fields
+	require.Equal(t, true, fields["online"])
+	require.Equal(t, true, fields["paired"])
+	require.Equal(t, 10, fields["category"])
+	require.Equal(t, 2, fields["config_number"])
+	require.Equal(t, "192.168.1.10:51826", fields["address"])
+}
+
+func newDiscoveryEntry(name string, id string, statusFlags string) dnssd.BrowseEntry {
+	return dnssd.BrowseEntry{
+		IPs:  []net.IP{net.ParseIP("192.168.1.10")},
+		Host: name + ".local.",
+		Port: 51826,
+		Name: name,
+		Type: "_hap._tcp",
+		Text: map[string]string{
+			"id": id,
+			"md": "Sensor",
+			"ci": "10",
+			"c#": "2",
+			"s#": "1",
+			"sf": statusFlags,
+			"ff": "0",
+			"pv": "1.1",
+		},
+	}
+}
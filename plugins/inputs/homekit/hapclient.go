@@ -0,0 +1,678 @@
+// hapclient.go
+//
+// Copyright (C) 2023-2024 Holger de Carne
+//
+// This software may be modified and distributed under the terms
+// of the MIT license.  See the LICENSE file for details.
+
+package homekit
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/sha512"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/textproto"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/brutella/hap"
+	"github.com/brutella/hap/chacha20poly1305"
+	"github.com/brutella/hap/curve25519"
+	"github.com/brutella/hap/hkdf"
+	"github.com/brutella/hap/tlv8"
+	"github.com/tadglines/go-pkgs/crypto/srp"
+)
+
+const hapContentTypeTLV8 = "application/pairing+tlv8"
+const hapContentTypeJSON = "application/hap+json"
+const hapFrameLengthMax = 0x400
+
+// errPairingRejected indicates that the accessory no longer accepts (or matches) a stored pairing.
+var errPairingRejected = errors.New("pairing rejected by accessory")
+
+// hapConn implements the HAP session security on top of a plain connection. As soon as a session has been
+// established via pair-verify, all data is exchanged as encrypted frames.
+type hapConn struct {
+	net.Conn
+	secure       bool
+	encryptKey   [32]byte
+	decryptKey   [32]byte
+	encryptCount uint64
+	decryptCount uint64
+	readBuf      []byte
+}
+
+func (conn *hapConn) upgrade(sharedKey []byte) error {
+	encryptKey, err := hkdf.Sha512(sharedKey, []byte("Control-Salt"), []byte("Control-Write-Encryption-Key"))
+	if err != nil {
+		return err
+	}
+	decryptKey, err := hkdf.Sha512(sharedKey, []byte("Control-Salt"), []byte("Control-Read-Encryption-Key"))
+	if err != nil {
+		return err
+	}
+	conn.encryptKey = encryptKey
+	conn.decryptKey = decryptKey
+	conn.secure = true
+	return nil
+}
+
+func (conn *hapConn) Read(b []byte) (int, error) {
+	if !conn.secure {
+		return conn.Conn.Read(b)
+	}
+	if len(conn.readBuf) == 0 {
+		err := conn.readFrame()
+		if err != nil {
+			return 0, err
+		}
+	}
+	n := copy(b, conn.readBuf)
+	conn.readBuf = conn.readBuf[n:]
+	return n, nil
+}
+
+func (conn *hapConn) readFrame() error {
+	lengthBytes := make([]byte, 2)
+	_, err := io.ReadFull(conn.Conn, lengthBytes)
+	if err != nil {
+		return err
+	}
+	length := binary.LittleEndian.Uint16(lengthBytes)
+	frame := make([]byte, int(length)+16)
+	_, err = io.ReadFull(conn.Conn, frame)
+	if err != nil {
+		return err
+	}
+	var mac [16]byte
+	copy(mac[:], frame[length:])
+	nonce := make([]byte, 8)
+	binary.LittleEndian.PutUint64(nonce, conn.decryptCount)
+	conn.decryptCount++
+	decrypted, err := chacha20poly1305.DecryptAndVerify(conn.decryptKey[:], nonce, frame[:length], mac, lengthBytes)
+	if err != nil {
+		return fmt.Errorf("failed to decrypt frame (cause: %w)", err)
+	}
+	conn.readBuf = decrypted
+	return nil
+}
+
+func (conn *hapConn) Write(b []byte) (int, error) {
+	if !conn.secure {
+		return conn.Conn.Write(b)
+	}
+	var frames bytes.Buffer
+	for offset := 0; offset < len(b); offset += hapFrameLengthMax {
+		chunk := b[offset:min(offset+hapFrameLengthMax, len(b))]
+		lengthBytes := make([]byte, 2)
+		binary.LittleEndian.PutUint16(lengthBytes, uint16(len(chunk)))
+		nonce := make([]byte, 8)
+		binary.LittleEndian.PutUint64(nonce, conn.encryptCount)
+		conn.encryptCount++
+		encrypted, mac, err := chacha20poly1305.EncryptAndSeal(conn.encryptKey[:], nonce, chunk, lengthBytes)
+		if err != nil {
+			return 0, err
+		}
+		frames.Write(lengthBytes)
+		frames.Write(encrypted)
+		frames.Write(mac[:])
+	}
+	_, err := conn.Conn.Write(frames.Bytes())
+	if err != nil {
+		return 0, err
+	}
+	return len(b), nil
+}
+
+// hapClient sends HAP requests to an accessory via a single (persistent) connection. As soon as event
+// notifications are enabled, all incoming messages are read by a separate goroutine, which dispatches
+// responses to the pending request and events to the event handler. As HAP responses carry no request
+// reference, a request failing to receive its response in time closes the connection, so a late response
+// can never be mistaken for the response of a subsequent request.
+type hapClient struct {
+	address      string
+	timeout      time.Duration
+	conn         *hapConn
+	reader       *bufio.Reader
+	mutex        sync.Mutex
+	receiving    chan struct{}
+	pending      chan *hapMessage
+	pendingMutex sync.Mutex
+	receiveErr   error
+}
+
+type hapMessage struct {
+	event      bool
+	statusCode int
+	body       []byte
+}
+
+func dialHAP(ctx context.Context, address string, timeout time.Duration) (*hapClient, error) {
+	dialer := &net.Dialer{Timeout: timeout}
+	conn, err := dialer.DialContext(ctx, "tcp", address)
+	if err != nil {
+		return nil, err
+	}
+	client := &hapClient{
+		address: address,
+		timeout: timeout,
+		conn:    &hapConn{Conn: conn},
+	}
+	client.reader = bufio.NewReader(client.conn)
+	return client, nil
+}
+
+func (client *hapClient) close() error {
+	return client.conn.Close()
+}
+
+// receiveEvents starts reading the incoming messages in the background and passes all event notifications
+// to the given handler. The returned channel is closed as soon as the connection is lost.
+func (client *hapClient) receiveEvents(handler func(*hapCharacteristics)) (<-chan struct{}, error) {
+	err := client.conn.SetReadDeadline(time.Time{})
+	if err != nil {
+		return nil, err
+	}
+	receiving := make(chan struct{})
+	client.receiving = receiving
+	go func() {
+		defer close(receiving)
+		for {
+			message, err := client.readMessage()
+			if err != nil {
+				client.receiveErr = err
+				return
+			}
+			if !message.event {
+				client.dispatchResponse(message)
+				continue
+			}
+			characteristics := &hapCharacteristics{}
+			err = json.Unmarshal(message.body, characteristics)
+			if err == nil {
+				handler(characteristics)
+			}
+		}
+	}()
+	return receiving, nil
+}
+
+// dispatchResponse passes the given response to the pending request. Responses not expected by any request are
+// dropped, so they neither block the receiving goroutine nor are mistaken for the response of a later request.
+func (client *hapClient) dispatchResponse(rsp *hapMessage) {
+	client.pendingMutex.Lock()
+	pending := client.pending
+	client.pending = nil
+	client.pendingMutex.Unlock()
+	if pending != nil {
+		pending <- rsp
+	}
+}
+
+func (client *hapClient) setPending(pending chan *hapMessage) {
+	client.pendingMutex.Lock()
+	defer client.pendingMutex.Unlock()
+	client.pending = pending
+}
+
+func (client *hapClient) do(method string, path string, contentType string, body []byte) ([]byte, error) {
+	req, err := http.NewRequest(method, "http://"+client.address+path, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	var reqBytes bytes.Buffer
+	err = req.Write(&reqBytes)
+	if err != nil {
+		return nil, err
+	}
+	client.mutex.Lock()
+	defer client.mutex.Unlock()
+	deadline := time.Now().Add(client.timeout)
+	err = client.conn.SetWriteDeadline(deadline)
+	if err != nil {
+		return nil, err
+	}
+	if client.receiving != nil {
+		return client.doReceiving(method, path, reqBytes.Bytes())
+	}
+	_, err = client.conn.Write(reqBytes.Bytes())
+	if err != nil {
+		client.close()
+		return nil, err
+	}
+	err = client.conn.SetReadDeadline(deadline)
+	if err != nil {
+		client.close()
+		return nil, err
+	}
+	rsp, err := client.readMessage()
+	if err != nil {
+		client.close()
+		return nil, err
+	}
+	return checkResponse(method, path, rsp)
+}
+
+// doReceiving sends a request while the incoming messages are read by the receiving goroutine and waits for the
+// response being dispatched to it.
+func (client *hapClient) doReceiving(method string, path string, reqBytes []byte) ([]byte, error) {
+	pending := make(chan *hapMessage, 1)
+	client.setPending(pending)
+	defer client.setPending(nil)
+	_, err := client.conn.Write(reqBytes)
+	if err != nil {
+		client.close()
+		return nil, err
+	}
+	timer := time.NewTimer(client.timeout)
+	defer timer.Stop()
+	var rsp *hapMessage
+	select {
+	case rsp = <-pending:
+	case <-client.receiving:
+		return nil, fmt.Errorf("connection lost (cause: %w)", client.receiveErr)
+	case <-timer.C:
+		client.close()
+		return nil, fmt.Errorf("%s %s timed out", method, path)
+	}
+	return checkResponse(method, path, rsp)
+}
+
+func checkResponse(method string, path string, rsp *hapMessage) ([]byte, error) {
+	if rsp.statusCode != http.StatusOK && rsp.statusCode != http.StatusNoContent && rsp.statusCode != http.StatusMultiStatus {
+		return nil, fmt.Errorf("%s %s failed with status %d", method, path, rsp.statusCode)
+	}
+	return rsp.body, nil
+}
+
+// readMessage reads the next incoming message, which is either a response or an event notification (which is
+// a response with protocol EVENT/1.0).
+func (client *hapClient) readMessage() (*hapMessage, error) {
+	protocol, err := client.reader.Peek(6)
+	if err != nil {
+		return nil, err
+	}
+	if string(protocol) != "EVENT/" {
+		rsp, err := http.ReadResponse(client.reader, nil)
+		if err != nil {
+			return nil, err
+		}
+		defer rsp.Body.Close()
+		body, err := io.ReadAll(rsp.Body)
+		if err != nil {
+			return nil, err
+		}
+		return &hapMessage{statusCode: rsp.StatusCode, body: body}, nil
+	}
+	reader := textproto.NewReader(client.reader)
+	_, err = reader.ReadLine()
+	if err != nil {
+		return nil, err
+	}
+	header, err := reader.ReadMIMEHeader()
+	if err != nil {
+		return nil, err
+	}
+	contentLength, err := strconv.Atoi(header.Get("Content-Length"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid event content length (cause: %w)", err)
+	}
+	body := make([]byte, contentLength)
+	_, err = io.ReadFull(client.reader, body)
+	if err != nil {
+		return nil, err
+	}
+	return &hapMessage{event: true, statusCode: http.StatusOK, body: body}, nil
+}
+
+func (client *hapClient) exchangeTLV8(path string, request interface{}, response interface{}) error {
+	reqBody, err := tlv8.Marshal(request)
+	if err != nil {
+		return err
+	}
+	rspBody, err := client.do(http.MethodPost, path, hapContentTypeTLV8, reqBody)
+	if err != nil {
+		return err
+	}
+	return tlv8.Unmarshal(rspBody, response)
+}
+
+type hapPairRequest struct {
+	Method byte `tlv8:"0"`
+	State  byte `tlv8:"6"`
+}
+
+type hapProofRequest struct {
+	PublicKey []byte `tlv8:"3"`
+	Proof     []byte `tlv8:"4"`
+	State     byte   `tlv8:"6"`
+}
+
+type hapKeyRequest struct {
+	PublicKey []byte `tlv8:"3"`
+	State     byte   `tlv8:"6"`
+}
+
+type hapEncryptedRequest struct {
+	EncryptedData []byte `tlv8:"5"`
+	State         byte   `tlv8:"6"`
+}
+
+type hapPairResponse struct {
+	Identifier    string `tlv8:"1,optional"`
+	Salt          []byte `tlv8:"2,optional"`
+	PublicKey     []byte `tlv8:"3,optional"`
+	Proof         []byte `tlv8:"4,optional"`
+	EncryptedData []byte `tlv8:"5,optional"`
+	State         byte   `tlv8:"6,optional"`
+	Error         byte   `tlv8:"7,optional"`
+	Signature     []byte `tlv8:"10,optional"`
+}
+
+// Note: The tlv8 encoder does not support the optional flag, hence separate types are used for the different
+// sub-TLVs.
+type hapSetupSubTLV struct {
+	Identifier string `tlv8:"1"`
+	PublicKey  []byte `tlv8:"3"`
+	Signature  []byte `tlv8:"10"`
+}
+
+type hapVerifySubTLV struct {
+	Identifier string `tlv8:"1"`
+	Signature  []byte `tlv8:"10"`
+}
+
+func (response *hapPairResponse) check(state byte) error {
+	if response.Error != 0 {
+		return fmt.Errorf("accessory reported error %d in state M%d", response.Error, state)
+	}
+	if response.State != state {
+		return fmt.Errorf("unexpected state M%d (expected M%d)", response.State, state)
+	}
+	return nil
+}
+
+func encryptSubTLV(key [32]byte, nonce string, subTLV interface{}) ([]byte, error) {
+	subTLVBytes, err := tlv8.Marshal(subTLV)
+	if err != nil {
+		return nil, err
+	}
+	encrypted, mac, err := chacha20poly1305.EncryptAndSeal(key[:], []byte(nonce), subTLVBytes, nil)
+	if err != nil {
+		return nil, err
+	}
+	return append(encrypted, mac[:]...), nil
+}
+
+func decryptSubTLV(key [32]byte, nonce string, encrypted []byte, subTLV interface{}) error {
+	if len(encrypted) < 16 {
+		return fmt.Errorf("encrypted data too short")
+	}
+	message := encrypted[:len(encrypted)-16]
+	var mac [16]byte
+	copy(mac[:], encrypted[len(message):])
+	decrypted, err := chacha20poly1305.DecryptAndVerify(key[:], []byte(nonce), message, mac, nil)
+	if err != nil {
+		return err
+	}
+	return tlv8.Unmarshal(decrypted, subTLV)
+}
+
+// pairSetup pairs the controller with the accessory using the accessory's setup pin (format XXX-XX-XXX).
+func (client *hapClient) pairSetup(identity *controllerIdentity, pin string) (*accessoryPairing, error) {
+	m2 := &hapPairResponse{}
+	err := client.exchangeTLV8("/pair-setup", &hapPairRequest{Method: hap.MethodPair, State: hap.M1}, m2)
+	if err != nil {
+		return nil, err
+	}
+	err = m2.check(hap.M2)
+	if err != nil {
+		return nil, err
+	}
+	srpContext, err := srp.NewSRP("rfc5054.3072", sha512.New, srpKeyDerivationFunc([]byte("Pair-Setup")))
+	if err != nil {
+		return nil, err
+	}
+	srpSession := srpContext.NewClientSession([]byte("Pair-Setup"), []byte(pin))
+	sessionKey, err := srpSession.ComputeKey(m2.Salt, m2.PublicKey)
+	if err != nil {
+		return nil, err
+	}
+	m4 := &hapPairResponse{}
+	err = client.exchangeTLV8("/pair-setup", &hapProofRequest{PublicKey: srpSession.GetA(), Proof: srpSession.ComputeAuthenticator(), State: hap.M3}, m4)
+	if err != nil {
+		return nil, err
+	}
+	err = m4.check(hap.M4)
+	if err != nil {
+		return nil, err
+	}
+	if !srpSession.VerifyServerAuthenticator(m4.Proof) {
+		return nil, fmt.Errorf("invalid accessory proof")
+	}
+	encryptionKey, err := hkdf.Sha512(sessionKey, []byte("Pair-Setup-Encrypt-Salt"), []byte("Pair-Setup-Encrypt-Info"))
+	if err != nil {
+		return nil, err
+	}
+	controllerX, err := hkdf.Sha512(sessionKey, []byte("Pair-Setup-Controller-Sign-Salt"), []byte("Pair-Setup-Controller-Sign-Info"))
+	if err != nil {
+		return nil, err
+	}
+	controllerInfo := append(append(controllerX[:], []byte(identity.ID)...), identity.PublicKey...)
+	m5Data, err := encryptSubTLV(encryptionKey, "PS-Msg05", &hapSetupSubTLV{
+		Identifier: identity.ID,
+		PublicKey:  identity.PublicKey,
+		Signature:  ed25519.Sign(identity.PrivateKey, controllerInfo),
+	})
+	if err != nil {
+		return nil, err
+	}
+	m6 := &hapPairResponse{}
+	err = client.exchangeTLV8("/pair-setup", &hapEncryptedRequest{EncryptedData: m5Data, State: hap.M5}, m6)
+	if err != nil {
+		return nil, err
+	}
+	err = m6.check(hap.M6)
+	if err != nil {
+		return nil, err
+	}
+	m6Data := &hapSetupSubTLV{}
+	err = decryptSubTLV(encryptionKey, "PS-Msg06", m6.EncryptedData, m6Data)
+	if err != nil {
+		return nil, err
+	}
+	accessoryX, err := hkdf.Sha512(sessionKey, []byte("Pair-Setup-Accessory-Sign-Salt"), []byte("Pair-Setup-Accessory-Sign-Info"))
+	if err != nil {
+		return nil, err
+	}
+	accessoryInfo := append(append(accessoryX[:], []byte(m6Data.Identifier)...), m6Data.PublicKey...)
+	if len(m6Data.PublicKey) != ed25519.PublicKeySize || !ed25519.Verify(m6Data.PublicKey, accessoryInfo, m6Data.Signature) {
+		return nil, fmt.Errorf("invalid accessory signature")
+	}
+	return &accessoryPairing{ID: m6Data.Identifier, PublicKey: m6Data.PublicKey, Address: client.address}, nil
+}
+
+// pairVerify verifies the pairing with the accessory and upgrades the connection to an encrypted session.
+func (client *hapClient) pairVerify(identity *controllerIdentity, pairing *accessoryPairing) error {
+	publicKey, privateKey := curve25519.GenerateKeyPair()
+	m2 := &hapPairResponse{}
+	err := client.exchangeTLV8("/pair-verify", &hapKeyRequest{PublicKey: publicKey[:], State: hap.M1}, m2)
+	if err != nil {
+		return err
+	}
+	err = m2.check(hap.M2)
+	if err != nil {
+		return checkPairingRejected(m2, err)
+	}
+	var accessoryPublicKey [32]byte
+	copy(accessoryPublicKey[:], m2.PublicKey)
+	sharedKey := curve25519.SharedSecret(privateKey, accessoryPublicKey)
+	encryptionKey, err := hkdf.Sha512(sharedKey[:], []byte("Pair-Verify-Encrypt-Salt"), []byte("Pair-Verify-Encrypt-Info"))
+	if err != nil {
+		return err
+	}
+	m2Data := &hapVerifySubTLV{}
+	err = decryptSubTLV(encryptionKey, "PV-Msg02", m2.EncryptedData, m2Data)
+	if err != nil {
+		return err
+	}
+	if m2Data.Identifier != pairing.ID {
+		return fmt.Errorf("%w: unexpected accessory '%s' (expected '%s')", errPairingRejected, m2Data.Identifier, pairing.ID)
+	}
+	accessoryInfo := append(append(accessoryPublicKey[:], []byte(m2Data.Identifier)...), publicKey[:]...)
+	if len(pairing.PublicKey) != ed25519.PublicKeySize || !ed25519.Verify(pairing.PublicKey, accessoryInfo, m2Data.Signature) {
+		return fmt.Errorf("%w: invalid accessory signature", errPairingRejected)
+	}
+	controllerInfo := append(append(publicKey[:], []byte(identity.ID)...), accessoryPublicKey[:]...)
+	m3Data, err := encryptSubTLV(encryptionKey, "PV-Msg03", &hapVerifySubTLV{
+		Identifier: identity.ID,
+		Signature:  ed25519.Sign(identity.PrivateKey, controllerInfo),
+	})
+	if err != nil {
+		return err
+	}
+	m4 := &hapPairResponse{}
+	err = client.exchangeTLV8("/pair-verify", &hapEncryptedRequest{EncryptedData: m3Data, State: hap.M3}, m4)
+	if err != nil {
+		return err
+	}
+	err = m4.check(hap.M4)
+	if err != nil {
+		return checkPairingRejected(m4, err)
+	}
+	return client.conn.upgrade(sharedKey[:])
+}
+
+// checkPairingRejected marks the errors an accessory reports if it does not know (or no longer trusts) the controller.
+func checkPairingRejected(response *hapPairResponse, err error) error {
+	if response.Error == hap.TlvErrorAuthentication || response.Error == hap.TlvErrorUnknownPeer {
+		return fmt.Errorf("%w: %v", errPairingRejected, err)
+	}
+	return err
+}
+
+type hapAccessories struct {
+	Accessories []hapAccessory `json:"accessories"`
+}
+
+type hapAccessory struct {
+	Aid      uint64       `json:"aid"`
+	Services []hapService `json:"services"`
+}
+
+type hapService struct {
+	Iid             uint64              `json:"iid"`
+	Type            string              `json:"type"`
+	Characteristics []hapCharacteristic `json:"characteristics"`
+}
+
+type hapCharacteristics struct {
+	Characteristics []hapCharacteristic `json:"characteristics"`
+}
+
+type hapCharacteristic struct {
+	Aid    uint64      `json:"aid,omitempty"`
+	Iid    uint64      `json:"iid"`
+	Type   string      `json:"type,omitempty"`
+	Perms  []string    `json:"perms,omitempty"`
+	Value  interface{} `json:"value,omitempty"`
+	Status int         `json:"status,omitempty"`
+	Events bool        `json:"ev,omitempty"`
+}
+
+func (client *hapClient) getAccessories() (*hapAccessories, error) {
+	rspBody, err := client.do(http.MethodGet, "/accessories", "", nil)
+	if err != nil {
+		return nil, err
+	}
+	accessories := &hapAccessories{}
+	err = json.Unmarshal(rspBody, accessories)
+	if err != nil {
+		return nil, err
+	}
+	return accessories, nil
+}
+
+func (client *hapClient) getCharacteristics(ids []string) (*hapCharacteristics, error) {
+	rspBody, err := client.do(http.MethodGet, "/characteristics?id="+strings.Join(ids, ","), "", nil)
+	if err != nil {
+		return nil, err
+	}
+	characteristics := &hapCharacteristics{}
+	err = json.Unmarshal(rspBody, characteristics)
+	if err != nil {
+		return nil, err
+	}
+	return characteristics, nil
+}
+
+func (client *hapClient) subscribeCharacteristics(characteristics []hapCharacteristic) error {
+	body, err := json.Marshal(&hapCharacteristics{Characteristics: characteristics})
+	if err != nil {
+		return err
+	}
+	rspBody, err := client.do(http.MethodPut, "/characteristics", hapContentTypeJSON, body)
+	if err != nil {
+		return err
+	}
+	if len(rspBody) > 0 {
+		statuses := &hapCharacteristics{}
+		err = json.Unmarshal(rspBody, statuses)
+		if err != nil {
+			return err
+		}
+		for _, status := range statuses.Characteristics {
+			if status.Status != 0 {
+				return fmt.Errorf("subscription of %d.%d failed with status %d", status.Aid, status.Iid, status.Status)
+			}
+		}
+	}
+	return nil
+}
+
+// hapShortType converts the given HAP type to its short form (e.g. 00000011-0000-1000-8000-0026BB765291 to 11).
+func hapShortType(hapType string) string {
+	hapType = strings.ToUpper(hapType)
+	if strings.HasSuffix(hapType, "-0000-1000-8000-0026BB765291") {
+		hapType = strings.TrimLeft(strings.SplitN(hapType, "-", 2)[0], "0")
+	}
+	return hapType
+}
+
+func srpKeyDerivationFunc(id []byte) srp.KeyDerivationFunc {
+	return func(salt []byte, pin []byte) []byte {
+		h := sha512.New()
+		h.Write(id)
+		h.Write([]byte(":"))
+		h.Write(pin)
+		t := h.Sum(nil)
+		h.Reset()
+		h.Write(salt)
+		h.Write(t)
+		return h.Sum(nil)
+	}
+}
+
+func newControllerID() (string, error) {
+	id := make([]byte, 16)
+	_, err := rand.Read(id)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%X-%X-%X-%X-%X", id[0:4], id[4:6], id[6:8], id[8:10], id[10:16]), nil
+}
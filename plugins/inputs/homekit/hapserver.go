@@ -0,0 +1,50 @@
+// hapserver.go
+//
+// Copyright (C) 2023-2024 Holger de Carne
+//
+// This software may be modified and distributed under the terms
+// of the MIT license.  See the LICENSE file for details.
+
+package homekit
+
+import (
+	"fmt"
+
+	"github.com/brutella/hap"
+	"github.com/brutella/hap/accessory"
+)
+
+// AccessoryInfo gets the accessory information to use for an accessory published by this plugin.
+func AccessoryInfo(name string) accessory.Info {
+	return accessory.Info{
+		Name:         name,
+		SerialNumber: serialNumber,
+		Manufacturer: manufacturer,
+		Firmware:     firmware,
+		Model:        model,
+	}
+}
+
+// NewHAPServer sets up a HAP server publishing the given accessories on the given address. The pin is either
+// a fixed 8 digit pin or "random" to generate a random pin and keep it in the HAP store. Besides the server,
+// the setup URI for pairing the accessory is returned.
+func NewHAPServer(store hap.Store, address string, pin string, a *accessory.A, as ...*accessory.A) (*hap.Server, string, error) {
+	server, err := hap.NewServer(store, a, as...)
+	if err != nil {
+		return nil, "", err
+	}
+	server.Addr = address
+	server.Pin, err = loadOrCreatePin(store, pin)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to set up pin (cause: %w)", err)
+	}
+	server.SetupId, err = loadOrCreateSetupID(store)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to set up setup id (cause: %w)", err)
+	}
+	uri, err := setupURI(a.Type, server.Pin, server.SetupId)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to set up setup URI (cause: %w)", err)
+	}
+	return server, uri, nil
+}
@@ -10,21 +10,24 @@ package homekit
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"net"
 	"net/http"
 	"os"
+	"sort"
 	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	dnssdlog "github.com/brutella/dnssd/log"
 	"github.com/brutella/hap"
-	"github.com/brutella/hap/accessory"
 	haplog "github.com/brutella/hap/log"
 	"github.com/influxdata/telegraf"
+	"github.com/influxdata/telegraf/config"
 	"github.com/influxdata/telegraf/plugins/inputs"
 )
 
@@ -33,42 +36,134 @@ var firmware = "0.0.0"
 var manufacturer = "https://hdecarne-github.github.io/homekit-telegraf-plugin/"
 var model = "homekit-telegraf-plugin"
 
+var errUnrecognizedValueType = errors.New("unrecognized value type")
+
 type HomeKit struct {
-	Address              string   `toml:"address"`
-	MonitorPath          string   `toml:"monitor_path"`
-	MonitorHosts         []string `toml:"monitor_hosts"`
-	HAPStorePath         string   `toml:"hap_store_path"`
-	MonitorAccessoryName string   `toml:"monitor_accessory_name"`
-	MonitorAccessoryPin  string   `toml:"monitor_accessory_pin"`
-	CelsiusSuffixes      []string `toml:"celsius_suffixex"`
-	FahrenheitSuffixes   []string `toml:"fahrenheit_suffixes"`
-	LuxSuffixes          []string `toml:"lux_suffixes"`
-	HueSuffixes          []string `toml:"hue_suffixes"`
-	ActiveValues         []string `toml:"active_values"`
-	InactiveValues       []string `toml:"inactive_values"`
-	Debug                bool     `toml:"debug"`
-	HAPDebug             bool     `toml:"hap_debug"`
-	DNSSDDebug           bool     `toml:"dnssd_debug"`
+	Address              string            `toml:"address"`
+	MonitorAddress       string            `toml:"monitor_address"`
+	MonitorReadTimeout   config.Duration   `toml:"monitor_read_timeout"`
+	MonitorWriteTimeout  config.Duration   `toml:"monitor_write_timeout"`
+	MonitorMaxBodySize   config.Size       `toml:"monitor_max_body_size"`
+	MonitorRateLimit     float64           `toml:"monitor_rate_limit"`
+	MonitorRateBurst     int               `toml:"monitor_rate_burst"`
+	MonitorMaxConcurrent int               `toml:"monitor_max_concurrent"`
+	MonitorPath          string            `toml:"monitor_path"`
+	MonitorHosts         []string          `toml:"monitor_hosts"`
+	StatusPath           string            `toml:"status_path"`
+	MetricsPath          string            `toml:"metrics_path"`
+	MetricsExpiry        config.Duration   `toml:"metrics_expiry"`
+	RecordPath           string            `toml:"record_path"`
+	RecordMaxSize        config.Size       `toml:"record_max_size"`
+	RecordMaxFiles       int               `toml:"record_max_files"`
+	HAPStoreType         string            `toml:"hap_store_type"`
+	HAPStorePath         string            `toml:"hap_store_path"`
+	HAPStoreBackupPath   string            `toml:"hap_store_backup_path"`
+	HAPStoreEncryption   string            `toml:"hap_store_encryption"`
+	HAPStoreKeyEnv       string            `toml:"hap_store_key_env"`
+	HAPStoreKeyFile      string            `toml:"hap_store_key_file"`
+	HAPStoreKey          config.Secret     `toml:"hap_store_key"`
+	MonitorAccessoryName string            `toml:"monitor_accessory_name"`
+	MonitorAccessoryPin  string            `toml:"monitor_accessory_pin"`
+	MonitorBridge        bool              `toml:"monitor_bridge"`
+	TriggerType          string            `toml:"trigger_type"`
+	TriggerPulse         config.Duration   `toml:"trigger_pulse"`
+	TriggerTimeout       config.Duration   `toml:"trigger_timeout"`
+	TriggerRetries       int               `toml:"trigger_retries"`
+	Triggers             []TriggerConfig   `toml:"trigger"`
+	Sensors              []SensorConfig    `toml:"sensor"`
+	ControllerTimeout    config.Duration   `toml:"controller_timeout"`
+	Accessories          []AccessoryConfig `toml:"accessory"`
+	Discovery            bool              `toml:"discovery"`
+	DiscoveryInterval    config.Duration   `toml:"discovery_interval"`
+	DiscoveryRetention   config.Duration   `toml:"discovery_retention"`
+	CelsiusSuffixes      []string          `toml:"celsius_suffixes"`
+	FahrenheitSuffixes   []string          `toml:"fahrenheit_suffixes"`
+	LuxSuffixes          []string          `toml:"lux_suffixes"`
+	HueSuffixes          []string          `toml:"hue_suffixes"`
+	ActiveValues         []string          `toml:"active_values"`
+	InactiveValues       []string          `toml:"inactive_values"`
+	Debug                bool              `toml:"debug"`
+	HAPDebug             bool              `toml:"hap_debug"`
+	DNSSDDebug           bool              `toml:"dnssd_debug"`
+
+	CelsiusSuffixesDeprecated []string `toml:"celsius_suffixex" deprecated:"0.3.0;use 'celsius_suffixes' instead"`
 
 	Log telegraf.Logger
 
-	acc telegraf.Accumulator
+	acc      telegraf.Accumulator
+	status   *pluginStatus
+	recorder *monitorRecorder
+
+	rateLimiter         *rateLimiter
+	concurrencyLimiter  concurrencyLimiter
+	rejectedBodySize    atomic.Int64
+	rejectedRateLimit   atomic.Int64
+	rejectedConcurrency atomic.Int64
+	triggerRetries      atomic.Int64
+	triggerFailures     atomic.Int64
+	triggerCount        atomic.Int64
+	requestCounts       statusCounter
+	bytesReceived       atomic.Int64
+	fieldsAccepted      atomic.Int64
+	fieldsInvalidKey    atomic.Int64
+	fieldsInvalidType   atomic.Int64
+	fieldsParseError    atomic.Int64
+	processingTime      atomic.Int64
+	lastProcessingTime  atomic.Int64
+	unpairedWarned      atomic.Bool
+	monitorRemotes      remoteSet
 
-	accessory     *accessory.Switch
-	server        *hap.Server
-	serverCtx     context.Context
-	stopServer    context.CancelFunc
-	serverStopped sync.WaitGroup
+	triggers          []*trigger
+	sensors           []*derivedSensor
+	controller        *controllerIdentity
+	remoteAccessories []*remoteAccessory
+	pollRequests      chan struct{}
+	discovery         *discoveryInventory
+	store             hap.Store
+	accessoryPin      string
+	setupURI          string
+	server            *hap.Server
+	monitorServer     *http.Server
+	serverCtx         context.Context
+	stopServer        context.CancelFunc
+	serverStopped     sync.WaitGroup
 }
 
 func NewHomeKit() *HomeKit {
 	return &HomeKit{
 		Address:              ":8001",
+		MonitorAddress:       "",
+		MonitorReadTimeout:   config.Duration(10 * time.Second),
+		MonitorWriteTimeout:  config.Duration(10 * time.Second),
+		MonitorMaxBodySize:   config.Size(1024 * 1024),
+		MonitorRateLimit:     10.0,
+		MonitorRateBurst:     50,
+		MonitorMaxConcurrent: 8,
 		MonitorPath:          "/monitor",
 		MonitorHosts:         make([]string, 0),
+		StatusPath:           "",
+		MetricsPath:          "",
+		MetricsExpiry:        config.Duration(time.Hour),
+		RecordPath:           "",
+		RecordMaxSize:        config.Size(10 * 1024 * 1024),
+		RecordMaxFiles:       5,
+		HAPStoreType:         storeTypeFs,
 		HAPStorePath:         ".hap",
+		HAPStoreBackupPath:   "",
+		HAPStoreEncryption:   storeEncryptionNone,
+		HAPStoreKeyEnv:       "HOMEKIT_HAP_STORE_KEY",
+		HAPStoreKeyFile:      "",
 		MonitorAccessoryName: "Monitor",
 		MonitorAccessoryPin:  "00102003",
+		MonitorBridge:        false,
+		TriggerType:          triggerTypeSwitch,
+		TriggerPulse:         config.Duration(100 * time.Millisecond),
+		TriggerTimeout:       0,
+		TriggerRetries:       3,
+		ControllerTimeout:    config.Duration(10 * time.Second),
+		Discovery:            false,
+		DiscoveryInterval:    config.Duration(5 * time.Minute),
+		DiscoveryRetention:   config.Duration(time.Hour),
 		CelsiusSuffixes:      []string{" °C"},
 		FahrenheitSuffixes:   []string{" °F"},
 		LuxSuffixes:          []string{" lx"},
@@ -81,16 +176,72 @@ func (plugin *HomeKit) SampleConfig() string {
 	return `
   ## The address (host:port) to run the HAP server on
   # address = ":8001"
+  ## The address (host:port) to run a separate monitor server on (leave empty to use the HAP server)
+  # monitor_address = ""
+  ## The read and write timeouts of the separate monitor server
+  # monitor_read_timeout = "10s"
+  # monitor_write_timeout = "10s"
+  ## The maximum size of a monitor request body
+  # monitor_max_body_size = "1MiB"
+  ## The number of monitor requests per second and the burst size allowed per host (0 disables rate limiting)
+  # monitor_rate_limit = 10.0
+  # monitor_rate_burst = 50
+  ## The maximum number of concurrently processed monitor requests (0 disables the limit)
+  # monitor_max_concurrent = 8
   ## The path to receive monitor requests on
   # monitor_path = "/monitor"
-  ## The host names/IPs allowed to send monitor requests (leave empty to allow any host)
+  ## The host names/IPs allowed to send monitor requests (leave empty to allow any host; the setup code is only
+  ## shown on the status page if the allowed hosts are configured)
   # monitor_hosts = []
-  ## Only allow authorized clients to send monitor requests
+  ## The path to serve the status page on, e.g. "/status" (leave empty to disable the status page; the page is
+  ## served to the hosts allowed by monitor_hosts)
+  # status_path = ""
+  ## The path to serve the last received readings and the plugin stats in Prometheus format on (leave empty to disable)
+  # metrics_path = ""
+  ## The time after which a reading is no longer served in Prometheus format (0 keeps readings forever)
+  # metrics_expiry = "1h"
+  ## The file to record all accepted monitor requests to (leave empty to disable recording)
+  # record_path = ""
+  ## The maximum size of the record file and the number of record files to keep during rotation
+  # record_max_size = "10MiB"
+  # record_max_files = 5
+  ## The type of the HAP store (fs = directory with one file per entry, json, bbolt or sqlite = single file)
+  # hap_store_type = "fs"
+  ## The path to store the HAP state (e.g. paring state) in (a directory for the fs type, a file for all other types)
   # hap_store_path = ".hap"
+  ## The HAP store backup archive checked on startup and used by the export/import commands (leave empty to use
+  ## <hap_store_path>.backup)
+  # hap_store_backup_path = ""
+  ## Encrypt the HAP store entries with a key read from an environment variable (env), a file (file) or the
+  ## hap_store_key setting (secret). Set to none to store the entries unencrypted. An unencrypted HAP store is
+  ## encrypted on startup once encryption is enabled.
+  # hap_store_encryption = "none"
+  # hap_store_key_env = "HOMEKIT_HAP_STORE_KEY"
+  # hap_store_key_file = ""
+  # hap_store_key = ""
   ## The name of the monitor accessory to use for triggering home automation
   # monitor_accessory_name = "Monitor"
-  ## The pin to use for pairing the monitor accessory
-  # monitor_accessory_pin = 00102003
+  ## The pin to use for pairing the monitor accessory ("random" generates and stores a random pin)
+  # monitor_accessory_pin = "00102003"
+  ## Publish the monitor accessory as a bridge containing the trigger accessories
+  # monitor_bridge = false
+  ## The type of the trigger accessories (switch, programmable_switch, motion_sensor or occupancy_sensor)
+  # trigger_type = "switch"
+  ## How long the trigger accessories stay active when triggered
+  # trigger_pulse = "100ms"
+  ## Retrigger if no monitor request is received within this timeout (0 disables retrying). The timeout is doubled
+  ## on every retry.
+  # trigger_timeout = "0s"
+  ## The maximum number of retries
+  # trigger_retries = 3
+  ## The timeout for discovering and querying accessories in controller mode
+  # controller_timeout = "10s"
+  ## Report the HAP accessories advertised on the network (homekit_discovery measurement)
+  # discovery = false
+  ## The duration of a single discovery cycle. Accessories not seen during a cycle are reported offline.
+  # discovery_interval = "5m"
+  ## How long an accessory not seen anymore is still reported offline before it is dropped
+  # discovery_retention = "1h"
   ## Celsius temperature value suffixes
   # celsius_suffixes = [" °C"]
   ## Fahrenheit temperature value suffixes
@@ -105,6 +256,34 @@ func (plugin *HomeKit) SampleConfig() string {
   # inactive_values = ["No", "Nein"]
   ## Enable debug output
   # debug = false
+  ## Additional trigger accessories with their own trigger intervals (the monitor accessory becomes a bridge
+  ## for them). A trigger without an interval is triggered on every poll.
+  # [[inputs.homekit.trigger]]
+  #   name = "Monitor Fast"
+  #   type = "motion_sensor"
+  #   interval = "1m"
+  # [[inputs.homekit.trigger]]
+  #   name = "Monitor Slow"
+  #   interval = "30m"
+  ## Accessories to poll directly (controller mode). The plugin pairs itself as a HAP controller with the
+  ## accessory using its setup pin. The accessory is discovered via its name or device id unless an address is set.
+  # [[inputs.homekit.accessory]]
+  #   name = "Thermometer"
+  #   address = ""
+  #   pin = "031-45-154"
+  #   room = "Living Room"
+  #   ## Characteristics to subscribe to; changes are reported immediately instead of on the next poll
+  #   events = ["Motion"]
+  ## Virtual sensor accessories derived from the received readings (the monitor accessory becomes a bridge for
+  ## them). The sensor aggregates the given field (default: celsius, lux or active depending on the sensor type)
+  ## of the source readings using the given function (average, min, max, sum or last). A source matches all
+  ## readings starting with the given name[_room[_characteristic]].
+  # [[inputs.homekit.sensor]]
+  #   name = "Living Room Temperature"
+  #   type = "temperature"
+  #   function = "average"
+  #   field = "celsius"
+  #   sources = ["Thermometer1_Living Room", "Thermometer2_Living Room"]
 `
 }
 
@@ -113,17 +292,51 @@ func (plugin *HomeKit) Description() string {
 }
 
 func (plugin *HomeKit) Gather(acc telegraf.Accumulator) error {
-	if plugin.Debug {
-		plugin.Log.Infof("Triggering monitor accessory: %s", plugin.MonitorAccessoryName)
+	for _, trigger := range plugin.triggers {
+		if trigger.interval <= 0 {
+			plugin.fireTrigger(trigger)
+		}
 	}
-	plugin.accessory.Switch.On.SetValue(true)
-	time.Sleep(100 * time.Millisecond)
-	plugin.accessory.Switch.On.SetValue(false)
+	plugin.requestPoll()
+	plugin.gatherDiscovery(acc)
+	plugin.gatherPluginStats(acc)
 	return nil
 }
 
+func (plugin *HomeKit) gatherPluginStats(acc telegraf.Accumulator) {
+	tags := make(map[string]string)
+	tags["homekit_monitor"] = plugin.MonitorAccessoryName
+	acc.AddCounter("homekit_plugin", plugin.pluginStats(), tags)
+}
+
+func (plugin *HomeKit) pluginStats() map[string]interface{} {
+	fields := make(map[string]interface{})
+	fields["rejected_body_size"] = plugin.rejectedBodySize.Load()
+	fields["rejected_rate_limit"] = plugin.rejectedRateLimit.Load()
+	fields["rejected_concurrency"] = plugin.rejectedConcurrency.Load()
+	fields["trigger_retries"] = plugin.triggerRetries.Load()
+	fields["trigger_failures"] = plugin.triggerFailures.Load()
+	fields["triggers"] = plugin.triggerCount.Load()
+	plugin.requestCounts.addFields(fields)
+	fields["bytes_received"] = plugin.bytesReceived.Load()
+	fields["fields_accepted"] = plugin.fieldsAccepted.Load()
+	fields["fields_rejected_invalid_key"] = plugin.fieldsInvalidKey.Load()
+	fields["fields_rejected_unrecognized_value"] = plugin.fieldsInvalidType.Load()
+	fields["fields_rejected_parse_error"] = plugin.fieldsParseError.Load()
+	fields["processing_time_ns"] = plugin.processingTime.Load()
+	fields["processing_time_last_ns"] = plugin.lastProcessingTime.Load()
+	if connections, err := plugin.hapConnections(); err == nil {
+		fields["hap_connections"] = connections
+	}
+	controllers := plugin.pairedControllers()
+	fields["paired"] = controllers > 0
+	fields["controllers"] = controllers
+	return fields
+}
+
 func (plugin *HomeKit) Start(acc telegraf.Accumulator) error {
 	plugin.acc = acc
+	plugin.status = newPluginStatus()
 	if !plugin.Debug {
 		haplog.Info.Disable()
 		dnssdlog.Info.Disable()
@@ -137,41 +350,142 @@ func (plugin *HomeKit) Start(acc telegraf.Accumulator) error {
 	if plugin.DNSSDDebug {
 		dnssdlog.Debug.Enable()
 	}
-	plugin.Log.Infof("Setting up monitor accessory: %s", plugin.MonitorAccessoryName)
-	plugin.accessory = accessory.NewSwitch(accessory.Info{
-		Name:         plugin.MonitorAccessoryName,
-		SerialNumber: serialNumber,
-		Manufacturer: manufacturer,
-		Firmware:     firmware,
-		Model:        model,
-	})
-	plugin.Log.Infof("Starting HAP server: http://%s%s", plugin.Address, plugin.MonitorPath)
-	server, err := hap.NewServer(hap.NewFsStore(plugin.HAPStorePath), plugin.accessory.A)
+	plugin.rateLimiter = newRateLimiter(plugin.MonitorRateLimit, plugin.MonitorRateBurst)
+	plugin.concurrencyLimiter = newConcurrencyLimiter(plugin.MonitorMaxConcurrent)
+	if plugin.RecordPath != "" {
+		plugin.Log.Infof("Recording monitor requests to: %s", plugin.RecordPath)
+		plugin.recorder = newMonitorRecorder(plugin.RecordPath, int64(plugin.RecordMaxSize), plugin.RecordMaxFiles)
+	}
+	monitorAccessory, bridgedAccessories, err := plugin.setupAccessories()
+	if err != nil {
+		plugin.Log.Errorf("Failed to set up monitor accessory (%v)", err)
+		return err
+	}
+	plugin.Log.Infof("Starting HAP server: %s", plugin.Address)
+	plugin.checkStoreBackup()
+	store, err := plugin.openStore(true)
+	if err != nil {
+		plugin.Log.Errorf("Failed to open HAP store (%v)", err)
+		return err
+	}
+	plugin.store = store
+	started := false
+	defer func() {
+		if !started {
+			plugin.closeStore()
+			plugin.store = nil
+		}
+	}()
+	err = plugin.setupRemoteAccessories()
+	if err != nil {
+		plugin.Log.Errorf("Failed to set up controller (%v)", err)
+		return err
+	}
+	server, uri, err := NewHAPServer(plugin.store, plugin.Address, plugin.MonitorAccessoryPin, monitorAccessory, bridgedAccessories...)
 	if err != nil {
 		plugin.Log.Errorf("Failed to start HAP server (%v)", err)
 		return err
 	}
-	server.Addr = plugin.Address
-	server.Pin = plugin.MonitorAccessoryPin
-	server.ServeMux().HandleFunc(plugin.MonitorPath, plugin.monitor)
+	plugin.accessoryPin = server.Pin
+	plugin.setupURI = uri
+	plugin.logSetupCode()
+	var monitorListener net.Listener
+	if plugin.MonitorAddress == "" {
+		plugin.Log.Infof("Serving monitor requests via HAP server: http://%s%s", plugin.Address, plugin.MonitorPath)
+		for pattern, handler := range plugin.routes() {
+			server.ServeMux().Handle(pattern, plugin.trackRemotes(handler))
+		}
+	} else {
+		plugin.Log.Infof("Starting monitor server: http://%s%s", plugin.MonitorAddress, plugin.MonitorPath)
+		monitorListener, err = net.Listen("tcp", plugin.MonitorAddress)
+		if err != nil {
+			plugin.Log.Errorf("Failed to start monitor server (%v)", err)
+			return err
+		}
+		mux := http.NewServeMux()
+		for pattern, handler := range plugin.routes() {
+			mux.Handle(pattern, handler)
+		}
+		plugin.monitorServer = &http.Server{
+			Handler:      mux,
+			ReadTimeout:  time.Duration(plugin.MonitorReadTimeout),
+			WriteTimeout: time.Duration(plugin.MonitorWriteTimeout),
+		}
+	}
 	serverCtx, stopServer := context.WithCancel(context.Background())
+	plugin.serverCtx = serverCtx
+	plugin.stopServer = stopServer
 	plugin.serverStopped.Add(1)
 	go func() {
 		defer plugin.serverStopped.Done()
 		_ = server.ListenAndServe(serverCtx)
 	}()
+	plugin.scheduleTriggers(serverCtx)
+	plugin.startPolling(serverCtx)
+	plugin.startDiscovery(serverCtx)
+	if plugin.monitorServer != nil {
+		plugin.serverStopped.Add(1)
+		go func() {
+			defer plugin.serverStopped.Done()
+			_ = plugin.monitorServer.Serve(monitorListener)
+		}()
+	}
 	plugin.server = server
-	plugin.serverCtx = serverCtx
-	plugin.stopServer = stopServer
+	started = true
 	return nil
 }
 
 func (plugin *HomeKit) Stop() {
-	plugin.Log.Infof("Stopping HAP server: http://%s%s", plugin.Address, plugin.MonitorPath)
+	if plugin.monitorServer != nil {
+		plugin.Log.Infof("Stopping monitor server: http://%s%s", plugin.MonitorAddress, plugin.MonitorPath)
+		shutdownCtx, cancelShutdown := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancelShutdown()
+		_ = plugin.monitorServer.Shutdown(shutdownCtx)
+	}
+	plugin.Log.Infof("Stopping HAP server: %s", plugin.Address)
 	if plugin.stopServer != nil {
 		plugin.stopServer()
 	}
 	plugin.serverStopped.Wait()
+	plugin.closeRemoteAccessories()
+	plugin.closeStore()
+	if plugin.recorder != nil {
+		err := plugin.recorder.close()
+		if err != nil {
+			plugin.Log.Warnf("Failed to close record file %s (cause: %v)", plugin.RecordPath, err)
+		}
+	}
+}
+
+func (plugin *HomeKit) closeStore() {
+	if plugin.store == nil {
+		return
+	}
+	err := CloseHAPStore(plugin.store)
+	if err != nil {
+		plugin.Log.Warnf("Failed to close HAP store %s (cause: %v)", plugin.HAPStorePath, err)
+	}
+}
+
+func (plugin *HomeKit) routes() map[string]http.Handler {
+	routes := make(map[string]http.Handler)
+	routes[plugin.MonitorPath] = plugin.countRequests(plugin.limitBody(http.HandlerFunc(plugin.monitor)))
+	if plugin.StatusPath != "" {
+		routes[plugin.StatusPath] = http.HandlerFunc(plugin.statusPage)
+		routes[plugin.StatusPath+"/setup.png"] = http.HandlerFunc(plugin.setupCode)
+		routes[plugin.StatusPath+"/setup.svg"] = http.HandlerFunc(plugin.setupCode)
+	}
+	if plugin.MetricsPath != "" {
+		routes[plugin.MetricsPath] = http.HandlerFunc(plugin.metricsPage)
+	}
+	return routes
+}
+
+func (plugin *HomeKit) limitBody(handler http.Handler) http.Handler {
+	if plugin.MonitorMaxBodySize <= 0 {
+		return handler
+	}
+	return http.MaxBytesHandler(handler, int64(plugin.MonitorMaxBodySize))
 }
 
 func (plugin *HomeKit) monitor(res http.ResponseWriter, req *http.Request) {
@@ -202,32 +516,63 @@ func (plugin *HomeKit) monitor(res http.ResponseWriter, req *http.Request) {
 		res.WriteHeader(http.StatusBadRequest)
 		return
 	}
-	contentType := req.Header.Get("Content-type")
-	if contentType != "application/json" {
-		plugin.Log.Warnf("Invalid content type: %s", contentType)
-		res.WriteHeader(http.StatusBadRequest)
+	if !plugin.rateLimiter.allow(remoteHost(req.RemoteAddr), time.Now()) {
+		plugin.Log.Warnf("Rate limit exceeded for monitor host: %s", req.RemoteAddr)
+		plugin.rejectedRateLimit.Add(1)
+		res.WriteHeader(http.StatusTooManyRequests)
 		return
 	}
+	if !plugin.concurrencyLimiter.acquire() {
+		plugin.Log.Warnf("Too many concurrent monitor requests; rejecting: %s", req.RemoteAddr)
+		plugin.rejectedConcurrency.Add(1)
+		res.WriteHeader(http.StatusTooManyRequests)
+		return
+	}
+	defer plugin.concurrencyLimiter.release()
 	defer req.Body.Close()
 	bodyBytes, err := io.ReadAll(req.Body)
-	if err != nil {
+	plugin.bytesReceived.Add(int64(len(bodyBytes)))
+	var maxBytesErr *http.MaxBytesError
+	if errors.As(err, &maxBytesErr) {
+		plugin.Log.Warnf("Request body exceeds limit of %d bytes: %s", maxBytesErr.Limit, req.RemoteAddr)
+		plugin.rejectedBodySize.Add(1)
+		res.WriteHeader(http.StatusRequestEntityTooLarge)
+		return
+	} else if err != nil {
 		plugin.Log.Warnf("Inaccessible request body: %v", err)
 		res.WriteHeader(http.StatusBadRequest)
 		return
 	}
-	var data map[string]string
-	err = json.Unmarshal(bodyBytes, &data)
-	if err != nil {
+	contentType := req.Header.Get("Content-type")
+	data, err := decodeData(contentType, bodyBytes)
+	if errors.Is(err, errUnsupportedContentType) {
+		plugin.Log.Warnf("Invalid content type: %s", contentType)
+		res.WriteHeader(http.StatusBadRequest)
+		return
+	} else if err != nil {
 		plugin.Log.Warnf("Invalid request body: %v", err)
+		plugin.status.recordError(time.Now(), req.RemoteAddr, err)
 		res.WriteHeader(http.StatusBadRequest)
 		return
 	}
-	plugin.processData(data)
-	if plugin.Debug {
-		res.Write(bodyBytes)
-	} else {
-		res.Write([]byte("Ok"))
+	now := time.Now()
+	if plugin.recorder != nil {
+		err = plugin.recorder.record(&MonitorRecord{Time: now, Remote: req.RemoteAddr, Headers: req.Header, Body: string(bodyBytes)})
+		if err != nil {
+			plugin.Log.Warnf("Failed to record monitor request (cause: %v)", err)
+		}
 	}
+	report := plugin.processData(plugin.acc, data, now)
+	plugin.status.recordPush(now, req.RemoteAddr, report)
+	reportBytes, err := json.Marshal(report)
+	if err != nil {
+		plugin.Log.Errorf("Failed to encode monitor report (%v)", err)
+		res.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	res.Header().Set("Content-Type", "application/json")
+	res.WriteHeader(report.statusCode())
+	res.Write(reportBytes)
 }
 
 func (plugin *HomeKit) isAllowedMonitorHost(remote string) bool {
@@ -249,159 +594,216 @@ func (plugin *HomeKit) isAllowedMonitorHost(remote string) bool {
 	return false
 }
 
-func (plugin *HomeKit) processData(data map[string]string) {
-	for key, value := range data {
-		if plugin.Debug {
-			plugin.Log.Infof("Processing data: %s = %s", key, value)
-		}
-		keyParts := strings.SplitN(key, "_", 3)
-		name := ""
-		room := "undefined"
-		characteristic := "generic"
-		switch len(keyParts) {
-		case 1:
-			name = keyParts[0]
-		case 2:
-			name = keyParts[0]
-			room = keyParts[1]
-		case 3:
-			name = keyParts[0]
-			room = keyParts[1]
-			characteristic = keyParts[2]
-		default:
-			plugin.Log.Warnf("Ignoring invalid data key: %s = %s", key, value)
-			continue
+func remoteHost(remote string) string {
+	host, _, err := net.SplitHostPort(remote)
+	if err != nil {
+		return remote
+	}
+	return host
+}
+
+type dataResult struct {
+	Key            string                 `json:"key"`
+	Value          string                 `json:"value"`
+	Name           string                 `json:"name,omitempty"`
+	Room           string                 `json:"room,omitempty"`
+	Characteristic string                 `json:"characteristic,omitempty"`
+	Measurement    string                 `json:"measurement,omitempty"`
+	Fields         map[string]interface{} `json:"fields,omitempty"`
+	Error          string                 `json:"error,omitempty"`
+}
+
+type dataReport struct {
+	Accepted int           `json:"accepted"`
+	Rejected int           `json:"rejected"`
+	Results  []*dataResult `json:"results"`
+}
+
+func (report *dataReport) statusCode() int {
+	if report.Rejected == 0 {
+		return http.StatusOK
+	} else if report.Accepted == 0 {
+		return http.StatusUnprocessableEntity
+	}
+	return http.StatusMultiStatus
+}
+
+func (plugin *HomeKit) processData(acc telegraf.Accumulator, data map[string]string, timestamp time.Time) *dataReport {
+	keys := make([]string, 0, len(data))
+	for key := range data {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	report := &dataReport{Results: make([]*dataResult, 0, len(keys))}
+	for _, key := range keys {
+		result := plugin.processDataEntry(acc, key, data[key], timestamp)
+		if result.Error == "" {
+			report.Accepted++
+		} else {
+			report.Rejected++
 		}
-		err := plugin.processDataValue(name, room, characteristic, value)
-		if err != nil {
-			plugin.Log.Warnf("Ignoreing invalid data value: %s = %s (cause: %v)", key, value, err)
+		report.Results = append(report.Results, result)
+	}
+	return report
+}
+
+func (plugin *HomeKit) processDataEntry(acc telegraf.Accumulator, key string, value string, timestamp time.Time) *dataResult {
+	if plugin.Debug {
+		plugin.Log.Infof("Processing data: %s = %s", key, value)
+	}
+	result := &dataResult{Key: key, Value: value}
+	keyParts := strings.SplitN(key, "_", 3)
+	name := ""
+	room := "undefined"
+	characteristic := "generic"
+	switch len(keyParts) {
+	case 1:
+		name = keyParts[0]
+	case 2:
+		name = keyParts[0]
+		room = keyParts[1]
+	case 3:
+		name = keyParts[0]
+		room = keyParts[1]
+		characteristic = keyParts[2]
+	default:
+		plugin.Log.Warnf("Ignoring invalid data key: %s = %s", key, value)
+		plugin.fieldsInvalidKey.Add(1)
+		result.Error = "invalid data key"
+		return result
+	}
+	result.Name = name
+	result.Room = room
+	result.Characteristic = characteristic
+	measurement, fields, err := plugin.processDataValue(value)
+	if err != nil {
+		plugin.Log.Warnf("Ignoring invalid data value: %s = %s (cause: %v)", key, value, err)
+		if errors.Is(err, errUnrecognizedValueType) {
+			plugin.fieldsInvalidType.Add(1)
+		} else {
+			plugin.fieldsParseError.Add(1)
 		}
+		result.Error = err.Error()
+		return result
 	}
+	tags := make(map[string]string)
+	tags["homekit_monitor"] = plugin.MonitorAccessoryName
+	tags["homekit_name"] = name
+	tags["homekit_room"] = room
+	tags["homekit_characteristic"] = characteristic
+	acc.AddCounter(measurement, fields, tags, timestamp)
+	plugin.fieldsAccepted.Add(1)
+	plugin.updateSensors(name, room, characteristic, fields)
+	result.Measurement = measurement
+	result.Fields = fields
+	return result
 }
 
-func (plugin *HomeKit) processDataValue(name string, room string, characteristic string, value string) error {
+func (plugin *HomeKit) processDataValue(value string) (string, map[string]interface{}, error) {
 	for _, celsiusSuffix := range plugin.CelsiusSuffixes {
 		if strings.HasSuffix(value, celsiusSuffix) {
-			return plugin.processCelsiusValue(name, room, characteristic, value, celsiusSuffix)
+			return plugin.processCelsiusValue(value, celsiusSuffix)
 		}
 	}
 	for _, fahrenheitSuffix := range plugin.FahrenheitSuffixes {
 		if strings.HasSuffix(value, fahrenheitSuffix) {
-			return plugin.processFahrenheitValue(name, room, characteristic, value, fahrenheitSuffix)
+			return plugin.processFahrenheitValue(value, fahrenheitSuffix)
 		}
 	}
 	for _, luxSuffix := range plugin.LuxSuffixes {
 		if strings.HasSuffix(value, luxSuffix) {
-			return plugin.processLuxValue(name, room, characteristic, value, luxSuffix)
+			return plugin.processLuxValue(value, luxSuffix)
 		}
 	}
 	for _, hueSuffix := range plugin.HueSuffixes {
 		if strings.HasSuffix(value, hueSuffix) {
-			return plugin.processHueValue(name, room, characteristic, value, hueSuffix)
+			return plugin.processHueValue(value, hueSuffix)
 		}
 	}
 	for _, activeValue := range plugin.ActiveValues {
 		if value == activeValue {
-			return plugin.processStateValue(name, room, characteristic, true)
+			return plugin.processStateValue(true)
 		}
 	}
 	for _, inactiveValue := range plugin.InactiveValues {
 		if value == inactiveValue {
-			return plugin.processStateValue(name, room, characteristic, false)
+			return plugin.processStateValue(false)
 		}
 	}
-	return fmt.Errorf("unrecognized value type")
+	return "", nil, errUnrecognizedValueType
 }
 
-func (plugin *HomeKit) processCelsiusValue(name string, room string, characteristic string, value string, suffix string) error {
+func (plugin *HomeKit) processCelsiusValue(value string, suffix string) (string, map[string]interface{}, error) {
 	celsiusValue := strings.TrimSuffix(value, suffix)
 	celsius, err := plugin.parseFloat(celsiusValue)
 	if err != nil {
-		return err
+		return "", nil, err
 	}
-	tags := make(map[string]string)
-	tags["homekit_monitor"] = plugin.MonitorAccessoryName
-	tags["homekit_name"] = name
-	tags["homekit_room"] = room
-	tags["homekit_characteristic"] = characteristic
+	return plugin.processCelsius(celsius)
+}
+
+func (plugin *HomeKit) processCelsius(celsius float64) (string, map[string]interface{}, error) {
 	fields := make(map[string]interface{})
 	fields["celsius"] = celsius
 	fields["fahrenheit"] = (celsius * 1.8) + 32.0
-	plugin.acc.AddCounter("homekit_temperature", fields, tags)
-	return nil
+	return "homekit_temperature", fields, nil
 }
 
-func (plugin *HomeKit) processFahrenheitValue(name string, room string, characteristic string, value string, suffix string) error {
+func (plugin *HomeKit) processFahrenheitValue(value string, suffix string) (string, map[string]interface{}, error) {
 	fahrenheitValue := strings.TrimSuffix(value, suffix)
 	fahrenheit, err := plugin.parseFloat(fahrenheitValue)
 	if err != nil {
-		return err
+		return "", nil, err
 	}
-	tags := make(map[string]string)
-	tags["homekit_monitor"] = plugin.MonitorAccessoryName
-	tags["homekit_name"] = name
-	tags["homekit_room"] = room
-	tags["homekit_characteristic"] = characteristic
 	fields := make(map[string]interface{})
 	fields["celsius"] = (fahrenheit - 32.0) / 1.8
 	fields["fahrenheit"] = fahrenheit
-	plugin.acc.AddCounter("homekit_temperature", fields, tags)
-	return nil
+	return "homekit_temperature", fields, nil
 }
 
-func (plugin *HomeKit) processLuxValue(name string, room string, characteristic string, value string, suffix string) error {
+func (plugin *HomeKit) processLuxValue(value string, suffix string) (string, map[string]interface{}, error) {
 	luxValue := strings.TrimSuffix(value, suffix)
 	lux, err := plugin.parseFloat(luxValue)
 	if err != nil {
-		return err
+		return "", nil, err
 	}
-	tags := make(map[string]string)
-	tags["homekit_monitor"] = plugin.MonitorAccessoryName
-	tags["homekit_name"] = name
-	tags["homekit_room"] = room
-	tags["homekit_characteristic"] = characteristic
+	return plugin.processLux(lux)
+}
+
+func (plugin *HomeKit) processLux(lux float64) (string, map[string]interface{}, error) {
 	fields := make(map[string]interface{})
 	fields["lux"] = lux
-	plugin.acc.AddCounter("homekit_light_level", fields, tags)
-	return nil
+	return "homekit_light_level", fields, nil
 }
 
-func (plugin *HomeKit) processHueValue(name string, room string, characteristic string, value string, suffix string) error {
+func (plugin *HomeKit) processHueValue(value string, suffix string) (string, map[string]interface{}, error) {
 	hueValue := strings.TrimSuffix(value, suffix)
 	hue, err := strconv.Atoi(hueValue)
 	if err != nil {
-		return err
+		return "", nil, err
 	}
-	tags := make(map[string]string)
-	tags["homekit_monitor"] = plugin.MonitorAccessoryName
-	tags["homekit_name"] = name
-	tags["homekit_room"] = room
-	tags["homekit_characteristic"] = characteristic
+	return plugin.processHue(hue)
+}
+
+func (plugin *HomeKit) processHue(hue int) (string, map[string]interface{}, error) {
 	fields := make(map[string]interface{})
 	fields["hue"] = hue
-	plugin.acc.AddCounter("homekit_light_hue", fields, tags)
-	return nil
+	return "homekit_light_hue", fields, nil
 }
 
-func (plugin *HomeKit) processStateValue(name string, room string, characteristic string, active bool) error {
-	tags := make(map[string]string)
-	tags["homekit_monitor"] = plugin.MonitorAccessoryName
-	tags["homekit_name"] = name
-	tags["homekit_room"] = room
-	tags["homekit_characteristic"] = characteristic
+func (plugin *HomeKit) processStateValue(active bool) (string, map[string]interface{}, error) {
 	fields := make(map[string]interface{})
 	if active {
 		fields["active"] = 1
 	} else {
 		fields["active"] = 0
 	}
-	plugin.acc.AddCounter("homekit_state", fields, tags)
-	return nil
+	return "homekit_state", fields, nil
 }
 
 func (plugin *HomeKit) parseFloat(value string) (float64, error) {
-	comma := strings.LastIndex(value, ",")
-	cValue := value
+	cValue := strings.TrimSpace(value)
+	comma := strings.LastIndex(cValue, ",")
 	if comma >= 0 {
 		cValue = strings.ReplaceAll(cValue, ",", ".")
 	}
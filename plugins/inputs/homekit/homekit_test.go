@@ -7,13 +7,16 @@
 package homekit
 
 import (
+	"encoding/json"
 	"fmt"
 	"log"
 	"net"
 	"net/http"
 	"os"
+	"path/filepath"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/influxdata/telegraf/testutil"
 	"github.com/stretchr/testify/require"
@@ -54,6 +57,7 @@ func TestRunSuccess(t *testing.T) {
 	defer plugin.Stop()
 	require.NoError(t, plugin.Start(acc))
 	require.NoError(t, plugin.Gather(acc))
+	waitForAddress(t, address)
 
 	statusCode := putJson(t, address, `{
 		"Name": "Yes"
@@ -199,6 +203,230 @@ func TestRunSuccess(t *testing.T) {
 			"homekit_characteristic": "generic"})
 }
 
+func TestRunReport(t *testing.T) {
+	address := freeAddress(t)
+
+	plugin := NewHomeKit()
+	plugin.Address = address
+	plugin.HAPStorePath = "../../../build/.hap"
+	plugin.MonitorAccessoryName = "TestMonitor"
+	plugin.RecordPath = filepath.Join(t.TempDir(), "monitor.jsonl")
+	plugin.Log = createDummyLogger()
+
+	acc := &testutil.Accumulator{}
+
+	defer plugin.Stop()
+	require.NoError(t, plugin.Start(acc))
+	require.NoError(t, plugin.Gather(acc))
+	waitForAddress(t, address)
+
+	statusCode, report := putJsonReport(t, address, `{
+		"Name_Room": "12.3 °C",
+		"Name_Room_Light": "Maybe"
+	}`)
+	require.Equal(t, http.StatusMultiStatus, statusCode)
+	require.Equal(t, 1, report.Accepted)
+	require.Equal(t, 1, report.Rejected)
+	require.Len(t, report.Results, 2)
+	require.Equal(t, "Name_Room", report.Results[0].Key)
+	require.Equal(t, "Name", report.Results[0].Name)
+	require.Equal(t, "Room", report.Results[0].Room)
+	require.Equal(t, "generic", report.Results[0].Characteristic)
+	require.Equal(t, "homekit_temperature", report.Results[0].Measurement)
+	require.Equal(t, 12.3, report.Results[0].Fields["celsius"])
+	require.Empty(t, report.Results[0].Error)
+	require.Equal(t, "Name_Room_Light", report.Results[1].Key)
+	require.Equal(t, "Light", report.Results[1].Characteristic)
+	require.Empty(t, report.Results[1].Measurement)
+	require.Equal(t, "unrecognized value type", report.Results[1].Error)
+
+	statusCode, report = putJsonReport(t, address, `{
+		"Name_Room": "12.3.4 °C"
+	}`)
+	require.Equal(t, http.StatusUnprocessableEntity, statusCode)
+	require.Equal(t, 0, report.Accepted)
+	require.Equal(t, 1, report.Rejected)
+
+	recordFile, err := os.Open(plugin.RecordPath)
+	require.NoError(t, err)
+	defer recordFile.Close()
+	records, err := ReadMonitorRecords(recordFile)
+	require.NoError(t, err)
+	require.Len(t, records, 2)
+	require.Equal(t, "application/json", records[0].Headers.Get("Content-Type"))
+}
+
+func putJsonReport(t *testing.T, address string, body string) (int, *dataReport) {
+	req, err := http.NewRequest(http.MethodPut, fmt.Sprintf("http://%s/monitor", address), strings.NewReader(body))
+	require.NoError(t, err)
+	req.Header.Add("Content-type", "application/json")
+	rsp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	defer rsp.Body.Close()
+	require.Equal(t, "application/json", rsp.Header.Get("Content-Type"))
+	report := &dataReport{}
+	require.NoError(t, json.NewDecoder(rsp.Body).Decode(report))
+	return rsp.StatusCode, report
+}
+
+func TestRunSeparateMonitor(t *testing.T) {
+	address := freeAddress(t)
+	monitorAddress := freeAddress(t)
+
+	plugin := NewHomeKit()
+	plugin.Address = address
+	plugin.MonitorAddress = monitorAddress
+	plugin.MonitorMaxBodySize = 64
+	plugin.HAPStorePath = "../../../build/.hap"
+	plugin.MonitorAccessoryName = "TestMonitor"
+	plugin.Log = createDummyLogger()
+	plugin.Debug = true
+
+	acc := &testutil.Accumulator{}
+
+	defer plugin.Stop()
+	require.NoError(t, plugin.Start(acc))
+
+	statusCode := putJson(t, monitorAddress, `{
+		"Name": "Yes"
+	}`)
+	require.Equal(t, http.StatusOK, statusCode)
+	acc.AssertContainsTaggedFields(t, "homekit_state",
+		map[string]interface{}{
+			"active": 1},
+		map[string]string{
+			"homekit_monitor":        "TestMonitor",
+			"homekit_name":           "Name",
+			"homekit_room":           "undefined",
+			"homekit_characteristic": "generic"})
+
+	statusCode = putJson(t, monitorAddress, fmt.Sprintf(`{
+		"Name": "%s"
+	}`, strings.Repeat("X", 64)))
+	require.Equal(t, http.StatusRequestEntityTooLarge, statusCode)
+
+	statusCode = putJson(t, monitorAddress, `{"Name":"Maybe","Name_Room":"x °C"}`)
+	require.Equal(t, http.StatusUnprocessableEntity, statusCode)
+
+	require.NoError(t, plugin.Gather(acc))
+	assertPluginStats(t, acc, map[string]interface{}{
+		"rejected_body_size":                 int64(1),
+		"rejected_rate_limit":                int64(0),
+		"rejected_concurrency":               int64(0),
+		"trigger_retries":                    int64(0),
+		"trigger_failures":                   int64(0),
+		"requests_200":                       int64(1),
+		"requests_413":                       int64(1),
+		"requests_422":                       int64(1),
+		"fields_accepted":                    int64(1),
+		"fields_rejected_invalid_key":        int64(0),
+		"fields_rejected_unrecognized_value": int64(1),
+		"fields_rejected_parse_error":        int64(1),
+		"paired":                             false,
+		"controllers":                        0})
+	stats, _ := acc.Get("homekit_plugin")
+	require.Greater(t, stats.Fields["bytes_received"], int64(0))
+	require.Greater(t, stats.Fields["processing_time_ns"], int64(0))
+}
+
+func TestRunRateLimit(t *testing.T) {
+	address := freeAddress(t)
+
+	plugin := NewHomeKit()
+	plugin.Address = address
+	plugin.MonitorRateLimit = 0.001
+	plugin.MonitorRateBurst = 1
+	plugin.HAPStorePath = "../../../build/.hap"
+	plugin.MonitorAccessoryName = "TestMonitor"
+	plugin.Log = createDummyLogger()
+	plugin.Debug = true
+
+	acc := &testutil.Accumulator{}
+
+	defer plugin.Stop()
+	require.NoError(t, plugin.Start(acc))
+	require.NoError(t, plugin.Gather(acc))
+	waitForAddress(t, address)
+
+	statusCode := putJson(t, address, `{
+		"Name": "Yes"
+	}`)
+	require.Equal(t, http.StatusOK, statusCode)
+	statusCode = putJson(t, address, `{
+		"Name": "Yes"
+	}`)
+	require.Equal(t, http.StatusTooManyRequests, statusCode)
+
+	acc.ClearMetrics()
+	require.NoError(t, plugin.Gather(acc))
+	assertPluginStats(t, acc, map[string]interface{}{
+		"rejected_body_size":   int64(0),
+		"rejected_rate_limit":  int64(1),
+		"rejected_concurrency": int64(0),
+		"trigger_retries":      int64(0),
+		"trigger_failures":     int64(0),
+		"paired":               false,
+		"controllers":          0})
+}
+
+func TestRunInvalidPin(t *testing.T) {
+	plugin := NewHomeKit()
+	plugin.Address = freeAddress(t)
+	plugin.HAPStorePath = "../../../build/.hap"
+	plugin.MonitorAccessoryPin = "12345678"
+	plugin.Log = createDummyLogger()
+
+	acc := &testutil.Accumulator{}
+
+	defer plugin.Stop()
+	require.Error(t, plugin.Start(acc))
+}
+
+func TestRunInvalidPinClosesStore(t *testing.T) {
+	storePath := filepath.Join(t.TempDir(), "hap.db")
+	plugin := NewHomeKit()
+	plugin.Address = freeAddress(t)
+	plugin.HAPStoreType = "bbolt"
+	plugin.HAPStorePath = storePath
+	plugin.MonitorAccessoryPin = "12345678"
+	plugin.Log = createDummyLogger()
+
+	acc := &testutil.Accumulator{}
+
+	require.Error(t, plugin.Start(acc))
+	store, err := OpenHAPStore("bbolt", storePath)
+	require.NoError(t, err)
+	require.NoError(t, CloseHAPStore(store))
+}
+
+func assertPluginStats(t *testing.T, acc *testutil.Accumulator, fields map[string]interface{}) {
+	stats, ok := acc.Get("homekit_plugin")
+	require.True(t, ok)
+	require.Equal(t, "TestMonitor", stats.Tags["homekit_monitor"])
+	for field, value := range fields {
+		require.Equal(t, value, stats.Fields[field], field)
+	}
+}
+
+func freeAddress(t *testing.T) string {
+	listener, err := net.Listen("tcp", "localhost:0")
+	require.NoError(t, err)
+	address := listener.Addr().String()
+	require.NoError(t, listener.Close())
+	return address
+}
+
+func waitForAddress(t *testing.T, address string) {
+	require.Eventually(t, func() bool {
+		conn, err := net.Dial("tcp", address)
+		if err != nil {
+			return false
+		}
+		conn.Close()
+		return true
+	}, time.Second, 10*time.Millisecond)
+}
+
 func putJson(t *testing.T, address string, json string) int {
 	req, err := http.NewRequest(http.MethodPut, fmt.Sprintf("http://%s/monitor", address), strings.NewReader(json))
 	require.NoError(t, err)
@@ -226,6 +454,7 @@ func TestRunFailures(t *testing.T) {
 	defer plugin.Stop()
 	require.NoError(t, plugin.Start(acc))
 	require.NoError(t, plugin.Gather(acc))
+	waitForAddress(t, address)
 
 	req, err := http.NewRequest(http.MethodPost, fmt.Sprintf("http://%s/monitor", address), strings.NewReader("<xml></xml>"))
 	require.NoError(t, err)
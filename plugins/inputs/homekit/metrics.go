@@ -0,0 +1,172 @@
+// metrics.go
+//
+// Copyright (C) 2023-2024 Holger de Carne
+//
+// This software may be modified and distributed under the terms
+// of the MIT license.  See the LICENSE file for details.
+
+package homekit
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const metricsContentType = "text/plain; version=0.0.4; charset=utf-8"
+
+// The plugin stats exposed as counters; all other plugin stats are exposed as gauges
+var metricsCounters = map[string]bool{
+	"rejected_body_size":   true,
+	"rejected_rate_limit":  true,
+	"rejected_concurrency": true,
+	"trigger_retries":      true,
+	"trigger_failures":     true,
+	"triggers":             true,
+	"bytes_received":       true,
+	"processing_time_ns":   true,
+}
+
+var metricsCounterPrefixes = []string{"requests_", "fields_"}
+
+func isMetricsCounter(field string) bool {
+	for _, prefix := range metricsCounterPrefixes {
+		if strings.HasPrefix(field, prefix) {
+			return true
+		}
+	}
+	return metricsCounters[field]
+}
+
+var metricsLabelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+type metricsFamily struct {
+	name    string
+	help    string
+	counter bool
+	samples []string
+}
+
+func (family *metricsFamily) addSample(labels map[string]string, value float64) {
+	labelNames := make([]string, 0, len(labels))
+	for labelName := range labels {
+		labelNames = append(labelNames, labelName)
+	}
+	sort.Strings(labelNames)
+	pairs := make([]string, 0, len(labelNames))
+	for _, labelName := range labelNames {
+		pairs = append(pairs, fmt.Sprintf(`%s="%s"`, labelName, metricsLabelEscaper.Replace(labels[labelName])))
+	}
+	family.samples = append(family.samples, fmt.Sprintf("%s{%s} %s", family.name, strings.Join(pairs, ","), strconv.FormatFloat(value, 'g', -1, 64)))
+}
+
+func (family *metricsFamily) write(w io.Writer) error {
+	metricType := "gauge"
+	if family.counter {
+		metricType = "counter"
+	}
+	_, err := fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n%s\n", family.name, family.help, family.name, metricType, strings.Join(family.samples, "\n"))
+	return err
+}
+
+func metricsValue(fieldValue interface{}) (float64, bool) {
+	switch value := fieldValue.(type) {
+	case float64:
+		return value, true
+	case int:
+		return float64(value), true
+	case int64:
+		return float64(value), true
+	case bool:
+		if value {
+			return 1, true
+		}
+		return 0, true
+	}
+	return 0, false
+}
+
+// metricsFamilies collects the non-expired readings and the plugin stats as metric families sorted by name.
+func (plugin *HomeKit) metricsFamilies(now time.Time) []*metricsFamily {
+	families := make(map[string]*metricsFamily)
+	family := func(name string, help string, counter bool) *metricsFamily {
+		metricFamily, ok := families[name]
+		if !ok {
+			metricFamily = &metricsFamily{name: name, help: help, counter: counter}
+			families[name] = metricFamily
+		}
+		return metricFamily
+	}
+	expiry := time.Duration(plugin.MetricsExpiry)
+	plugin.status.mutex.Lock()
+	readings := plugin.status.sortedReadings()
+	plugin.status.mutex.Unlock()
+	for _, reading := range readings {
+		if expiry > 0 && now.Sub(reading.Time) > expiry {
+			continue
+		}
+		labels := map[string]string{
+			"homekit_monitor":        plugin.MonitorAccessoryName,
+			"homekit_name":           reading.Name,
+			"homekit_room":           reading.Room,
+			"homekit_characteristic": reading.Characteristic,
+		}
+		for field, fieldValue := range reading.Fields {
+			value, ok := metricsValue(fieldValue)
+			if !ok {
+				continue
+			}
+			name := reading.Measurement + "_" + field
+			family(name, fmt.Sprintf("Last received %s %s", reading.Measurement, field), false).addSample(labels, value)
+		}
+	}
+	pluginLabels := map[string]string{"homekit_monitor": plugin.MonitorAccessoryName}
+	for field, fieldValue := range plugin.pluginStats() {
+		value, ok := metricsValue(fieldValue)
+		if !ok {
+			continue
+		}
+		counter := isMetricsCounter(field)
+		name := "homekit_plugin_" + field
+		if counter {
+			name += "_total"
+		}
+		family(name, "Plugin stat "+field, counter).addSample(pluginLabels, value)
+	}
+	sorted := make([]*metricsFamily, 0, len(families))
+	for _, metricFamily := range families {
+		sort.Strings(metricFamily.samples)
+		sorted = append(sorted, metricFamily)
+	}
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].name < sorted[j].name })
+	return sorted
+}
+
+func (plugin *HomeKit) metricsPage(res http.ResponseWriter, req *http.Request) {
+	if !plugin.isAllowedMonitorHost(req.RemoteAddr) {
+		plugin.Log.Warnf("Unallowed metrics host: %s", req.RemoteAddr)
+		res.WriteHeader(http.StatusForbidden)
+		return
+	}
+	if req.URL.Path != plugin.MetricsPath {
+		http.NotFound(res, req)
+		return
+	}
+	if req.Method != http.MethodGet {
+		plugin.Log.Warnf("Invalid method: %s", req.Method)
+		res.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	res.Header().Set("Content-Type", metricsContentType)
+	for _, family := range plugin.metricsFamilies(time.Now()) {
+		err := family.write(res)
+		if err != nil {
+			plugin.Log.Warnf("Failed to send metrics (cause: %v)", err)
+			return
+		}
+	}
+}
@@ -0,0 +1,70 @@
+// metrics_test.go
+//
+// # Copyright (C) 2023-2024 Holger de Carne
+//
+// This software may be modified and distributed under the terms
+// of the MIT license.  See the LICENSE file for details.
+package homekit
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/influxdata/telegraf/config"
+	"github.com/influxdata/telegraf/testutil"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMetricsPage(t *testing.T) {
+	address := freeAddress(t)
+
+	plugin := NewHomeKit()
+	plugin.Address = address
+	plugin.HAPStorePath = filepath.Join(t.TempDir(), ".hap")
+	plugin.MonitorAccessoryName = "TestMonitor"
+	plugin.MetricsPath = "/metrics"
+	plugin.MetricsExpiry = config.Duration(time.Minute)
+	plugin.Log = createDummyLogger()
+	require.NoError(t, plugin.Init())
+
+	acc := &testutil.Accumulator{}
+
+	defer plugin.Stop()
+	require.NoError(t, plugin.Start(acc))
+	waitForAddress(t, address)
+
+	putJson(t, address, `{
+		"Name_Room": "12.5 °C",
+		"Light_Room \"1\"_Light": "Yes"
+	}`)
+
+	rsp, err := http.Get(fmt.Sprintf("http://%s/metrics", address))
+	require.NoError(t, err)
+	defer rsp.Body.Close()
+	require.Equal(t, http.StatusOK, rsp.StatusCode)
+	require.Equal(t, metricsContentType, rsp.Header.Get("Content-Type"))
+	body, err := io.ReadAll(rsp.Body)
+	require.NoError(t, err)
+	metrics := string(body)
+	require.Contains(t, metrics, "# TYPE homekit_temperature_celsius gauge\n")
+	require.Contains(t, metrics, `homekit_temperature_celsius{homekit_characteristic="generic",homekit_monitor="TestMonitor",homekit_name="Name",homekit_room="Room"} 12.5`+"\n")
+	require.Contains(t, metrics, `homekit_state_active{homekit_characteristic="Light",homekit_monitor="TestMonitor",homekit_name="Light",homekit_room="Room \"1\""} 1`+"\n")
+	require.Contains(t, metrics, "# TYPE homekit_plugin_rejected_rate_limit_total counter\n")
+	require.Contains(t, metrics, `homekit_plugin_paired{homekit_monitor="TestMonitor"} 0`+"\n")
+
+	// Expired readings are dropped, the plugin stats remain
+	families := plugin.metricsFamilies(time.Now().Add(2 * time.Minute))
+	for _, family := range families {
+		require.Contains(t, family.name, "homekit_plugin_")
+	}
+	require.NotEmpty(t, families)
+
+	rsp, err = http.Post(fmt.Sprintf("http://%s/metrics", address), "text/plain", nil)
+	require.NoError(t, err)
+	defer rsp.Body.Close()
+	require.Equal(t, http.StatusMethodNotAllowed, rsp.StatusCode)
+}
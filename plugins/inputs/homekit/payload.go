@@ -0,0 +1,39 @@
+// payload.go
+//
+// Copyright (C) 2023-2024 Holger de Carne
+//
+// This software may be modified and distributed under the terms
+// of the MIT license.  See the LICENSE file for details.
+
+package homekit
+
+import (
+	"time"
+
+	"github.com/influxdata/telegraf"
+)
+
+// PayloadError describes a payload field rejected during processing.
+type PayloadError struct {
+	Key   string
+	Value string
+	Error string
+}
+
+// ProcessPayload decodes the given payload like a monitor request body and adds the resulting
+// measurements (using the given timestamp) to the given accumulator. Fields which cannot be processed
+// are returned as errors.
+func (plugin *HomeKit) ProcessPayload(acc telegraf.Accumulator, contentType string, payload []byte, timestamp time.Time) ([]PayloadError, error) {
+	data, err := decodeData(contentType, payload)
+	if err != nil {
+		return nil, err
+	}
+	report := plugin.processData(acc, data, timestamp)
+	errors := make([]PayloadError, 0, report.Rejected)
+	for _, result := range report.Results {
+		if result.Error != "" {
+			errors = append(errors, PayloadError{Key: result.Key, Value: result.Value, Error: result.Error})
+		}
+	}
+	return errors, nil
+}
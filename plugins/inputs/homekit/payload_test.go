@@ -0,0 +1,37 @@
+// payload_test.go
+//
+// # Copyright (C) 2023-2024 Holger de Carne
+//
+// This software may be modified and distributed under the terms
+// of the MIT license.  See the LICENSE file for details.
+package homekit
+
+import (
+	"testing"
+	"time"
+
+	"github.com/influxdata/telegraf/testutil"
+	"github.com/stretchr/testify/require"
+)
+
+func TestProcessPayload(t *testing.T) {
+	plugin := NewHomeKit()
+	plugin.Log = createDummyLogger()
+
+	acc := &testutil.Accumulator{}
+
+	errors, err := plugin.ProcessPayload(acc, "text/csv", []byte("Name_Room,10 lx\nName_Room_Light,Maybe\n"), time.Now())
+	require.NoError(t, err)
+	require.Equal(t, []PayloadError{{Key: "Name_Room_Light", Value: "Maybe", Error: "unrecognized value type"}}, errors)
+	acc.AssertContainsTaggedFields(t, "homekit_light_level",
+		map[string]interface{}{
+			"lux": 10.0},
+		map[string]string{
+			"homekit_monitor":        "Monitor",
+			"homekit_name":           "Name",
+			"homekit_room":           "Room",
+			"homekit_characteristic": "generic"})
+
+	_, err = plugin.ProcessPayload(acc, "application/xml", []byte("<xml></xml>"), time.Now())
+	require.Error(t, err)
+}
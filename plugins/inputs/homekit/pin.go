@@ -0,0 +1,63 @@
+// pin.go
+//
+// Copyright (C) 2023-2024 Holger de Carne
+//
+// This software may be modified and distributed under the terms
+// of the MIT license.  See the LICENSE file for details.
+
+package homekit
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/brutella/hap"
+)
+
+const randomPin = "random"
+const pinKey = "pin"
+const pinDigits = "0123456789"
+const pinLength = 8
+
+func normalizePin(pin string) (string, error) {
+	normalizedPin := strings.ReplaceAll(pin, "-", "")
+	if len(normalizedPin) != pinLength {
+		return "", fmt.Errorf("invalid pin '%s' (pin must consist of %d digits)", pin, pinLength)
+	}
+	for _, c := range normalizedPin {
+		if !strings.ContainsRune(pinDigits, c) {
+			return "", fmt.Errorf("invalid pin '%s' (pin must consist of %d digits)", pin, pinLength)
+		}
+	}
+	if hap.InvalidPins[normalizedPin] {
+		return "", fmt.Errorf("invalid pin '%s' (trivial pins are not allowed)", pin)
+	}
+	return normalizedPin, nil
+}
+
+func loadOrCreatePin(store hap.Store, pin string) (string, error) {
+	if pin != randomPin {
+		return normalizePin(pin)
+	}
+	storedPin, err := store.Get(pinKey)
+	if err == nil {
+		normalizedPin, err := normalizePin(string(storedPin))
+		if err == nil {
+			return normalizedPin, nil
+		}
+	}
+	for {
+		generatedPin, err := randomString(pinDigits, pinLength)
+		if err != nil {
+			return "", err
+		}
+		if hap.InvalidPins[generatedPin] {
+			continue
+		}
+		err = store.Set(pinKey, []byte(generatedPin))
+		if err != nil {
+			return "", err
+		}
+		return generatedPin, nil
+	}
+}
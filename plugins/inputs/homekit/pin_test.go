@@ -0,0 +1,45 @@
+// pin_test.go
+//
+// # Copyright (C) 2023-2024 Holger de Carne
+//
+// This software may be modified and distributed under the terms
+// of the MIT license.  See the LICENSE file for details.
+package homekit
+
+import (
+	"testing"
+
+	"github.com/brutella/hap"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNormalizePin(t *testing.T) {
+	pin, err := normalizePin("00102003")
+	require.NoError(t, err)
+	require.Equal(t, "00102003", pin)
+	pin, err = normalizePin("001-02-003")
+	require.NoError(t, err)
+	require.Equal(t, "00102003", pin)
+	_, err = normalizePin("12345678")
+	require.Error(t, err)
+	_, err = normalizePin("1234567")
+	require.Error(t, err)
+	_, err = normalizePin("1234567a")
+	require.Error(t, err)
+}
+
+func TestLoadOrCreatePin(t *testing.T) {
+	store := hap.NewMemStore()
+	pin1, err := loadOrCreatePin(store, randomPin)
+	require.NoError(t, err)
+	_, err = normalizePin(pin1)
+	require.NoError(t, err)
+	pin2, err := loadOrCreatePin(store, randomPin)
+	require.NoError(t, err)
+	require.Equal(t, pin1, pin2)
+	pin3, err := loadOrCreatePin(store, "001-02-003")
+	require.NoError(t, err)
+	require.Equal(t, "00102003", pin3)
+	_, err = loadOrCreatePin(store, "87654321")
+	require.Error(t, err)
+}
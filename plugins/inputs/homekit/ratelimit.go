@@ -0,0 +1,97 @@
+// ratelimit.go
+//
+// Copyright (C) 2023-2024 Holger de Carne
+//
+// This software may be modified and distributed under the terms
+// of the MIT license.  See the LICENSE file for details.
+
+package homekit
+
+import (
+	"sync"
+	"time"
+)
+
+const rateLimiterIdleTimeout = 10 * time.Minute
+
+type tokenBucket struct {
+	tokens  float64
+	updated time.Time
+}
+
+type rateLimiter struct {
+	rate    float64
+	burst   float64
+	buckets map[string]*tokenBucket
+	mutex   sync.Mutex
+}
+
+func newRateLimiter(rate float64, burst int) *rateLimiter {
+	if burst < 1 {
+		burst = 1
+	}
+	return &rateLimiter{
+		rate:    rate,
+		burst:   float64(burst),
+		buckets: make(map[string]*tokenBucket)}
+}
+
+func (limiter *rateLimiter) allow(host string, now time.Time) bool {
+	if limiter.rate <= 0 {
+		return true
+	}
+	limiter.mutex.Lock()
+	defer limiter.mutex.Unlock()
+	bucket := limiter.buckets[host]
+	if bucket == nil {
+		limiter.purge(now)
+		bucket = &tokenBucket{tokens: limiter.burst, updated: now}
+		limiter.buckets[host] = bucket
+	} else {
+		bucket.tokens += now.Sub(bucket.updated).Seconds() * limiter.rate
+		if bucket.tokens > limiter.burst {
+			bucket.tokens = limiter.burst
+		}
+		bucket.updated = now
+	}
+	if bucket.tokens < 1 {
+		return false
+	}
+	bucket.tokens--
+	return true
+}
+
+func (limiter *rateLimiter) purge(now time.Time) {
+	for host, bucket := range limiter.buckets {
+		if now.Sub(bucket.updated) > rateLimiterIdleTimeout {
+			delete(limiter.buckets, host)
+		}
+	}
+}
+
+type concurrencyLimiter chan struct{}
+
+func newConcurrencyLimiter(limit int) concurrencyLimiter {
+	if limit <= 0 {
+		return nil
+	}
+	return make(concurrencyLimiter, limit)
+}
+
+func (limiter concurrencyLimiter) acquire() bool {
+	if limiter == nil {
+		return true
+	}
+	select {
+	case limiter <- struct{}{}:
+		return true
+	default:
+		return false
+	}
+}
+
+func (limiter concurrencyLimiter) release() {
+	if limiter != nil {
+		<-limiter
+	}
+}
@@ -0,0 +1,42 @@
+// ratelimit_test.go
+//
+// # Copyright (C) 2023-2024 Holger de Carne
+//
+// This software may be modified and distributed under the terms
+// of the MIT license.  See the LICENSE file for details.
+package homekit
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestRateLimiter(t *testing.T) {
+	limiter := newRateLimiter(1.0, 2)
+	now := time.Now()
+	require.True(t, limiter.allow("host1", now))
+	require.True(t, limiter.allow("host1", now))
+	require.False(t, limiter.allow("host1", now))
+	require.True(t, limiter.allow("host2", now))
+	require.True(t, limiter.allow("host1", now.Add(time.Second)))
+	require.False(t, limiter.allow("host1", now.Add(time.Second)))
+}
+
+func TestRateLimiterDisabled(t *testing.T) {
+	limiter := newRateLimiter(0.0, 0)
+	now := time.Now()
+	for i := 0; i < 100; i++ {
+		require.True(t, limiter.allow("host", now))
+	}
+}
+
+func TestConcurrencyLimiter(t *testing.T) {
+	limiter := newConcurrencyLimiter(1)
+	require.True(t, limiter.acquire())
+	require.False(t, limiter.acquire())
+	limiter.release()
+	require.True(t, limiter.acquire())
+	require.True(t, newConcurrencyLimiter(0).acquire())
+}
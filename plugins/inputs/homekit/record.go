@@ -0,0 +1,139 @@
+// record.go
+//
+// Copyright (C) 2023-2024 Holger de Carne
+//
+// This software may be modified and distributed under the terms
+// of the MIT license.  See the LICENSE file for details.
+
+package homekit
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+)
+
+// MonitorRecord is a recorded monitor request.
+type MonitorRecord struct {
+	Time    time.Time   `json:"time"`
+	Remote  string      `json:"remote"`
+	Headers http.Header `json:"headers"`
+	Body    string      `json:"body"`
+}
+
+// ReadMonitorRecords reads the monitor records (one JSON object per line) from the given reader.
+func ReadMonitorRecords(reader io.Reader) ([]MonitorRecord, error) {
+	records := make([]MonitorRecord, 0)
+	scanner := bufio.NewScanner(reader)
+	scanner.Buffer(make([]byte, 0, 64*1024), 64*1024*1024)
+	line := 0
+	for scanner.Scan() {
+		line++
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+		var record MonitorRecord
+		err := json.Unmarshal(scanner.Bytes(), &record)
+		if err != nil {
+			return nil, fmt.Errorf("invalid monitor record in line %d (cause: %v)", line, err)
+		}
+		records = append(records, record)
+	}
+	return records, scanner.Err()
+}
+
+type monitorRecorder struct {
+	path     string
+	maxSize  int64
+	maxFiles int
+	file     *os.File
+	size     int64
+	mutex    sync.Mutex
+}
+
+func newMonitorRecorder(path string, maxSize int64, maxFiles int) *monitorRecorder {
+	return &monitorRecorder{path: path, maxSize: maxSize, maxFiles: maxFiles}
+}
+
+func (recorder *monitorRecorder) record(record *MonitorRecord) error {
+	recordBytes, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+	recordBytes = append(recordBytes, '\n')
+	recorder.mutex.Lock()
+	defer recorder.mutex.Unlock()
+	if recorder.file != nil && recorder.maxSize > 0 && recorder.size > 0 && recorder.size+int64(len(recordBytes)) > recorder.maxSize {
+		err = recorder.rotate()
+		if err != nil {
+			return err
+		}
+	}
+	if recorder.file == nil {
+		err = recorder.open()
+		if err != nil {
+			return err
+		}
+	}
+	written, err := recorder.file.Write(recordBytes)
+	recorder.size += int64(written)
+	return err
+}
+
+func (recorder *monitorRecorder) open() error {
+	file, err := os.OpenFile(recorder.path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0640)
+	if err != nil {
+		return err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return err
+	}
+	recorder.file = file
+	recorder.size = info.Size()
+	return nil
+}
+
+func (recorder *monitorRecorder) rotate() error {
+	err := recorder.file.Close()
+	recorder.file = nil
+	if err != nil {
+		return err
+	}
+	if recorder.maxFiles <= 1 {
+		return os.Remove(recorder.path)
+	}
+	err = os.Remove(recorder.rotatedPath(recorder.maxFiles - 1))
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	for i := recorder.maxFiles - 2; i >= 1; i-- {
+		err = os.Rename(recorder.rotatedPath(i), recorder.rotatedPath(i+1))
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+	}
+	return os.Rename(recorder.path, recorder.rotatedPath(1))
+}
+
+func (recorder *monitorRecorder) rotatedPath(index int) string {
+	return fmt.Sprintf("%s.%d", recorder.path, index)
+}
+
+func (recorder *monitorRecorder) close() error {
+	recorder.mutex.Lock()
+	defer recorder.mutex.Unlock()
+	if recorder.file == nil {
+		return nil
+	}
+	err := recorder.file.Close()
+	recorder.file = nil
+	return err
+}
@@ -0,0 +1,46 @@
+// record_test.go
+//
+// # Copyright (C) 2023-2024 Holger de Carne
+//
+// This software may be modified and distributed under the terms
+// of the MIT license.  See the LICENSE file for details.
+package homekit
+
+import (
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestMonitorRecorder(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "monitor.jsonl")
+	recorder := newMonitorRecorder(path, 200, 3)
+	defer recorder.close()
+
+	for i := 0; i < 10; i++ {
+		require.NoError(t, recorder.record(&MonitorRecord{
+			Time:    time.Now(),
+			Remote:  "127.0.0.1:1234",
+			Headers: http.Header{"Content-Type": []string{"application/json"}},
+			Body:    `{"Name":"Yes"}`}))
+	}
+	require.NoError(t, recorder.close())
+
+	require.FileExists(t, path)
+	require.FileExists(t, path+".1")
+	require.FileExists(t, path+".2")
+	require.NoFileExists(t, path+".3")
+
+	file, err := os.Open(path)
+	require.NoError(t, err)
+	defer file.Close()
+	records, err := ReadMonitorRecords(file)
+	require.NoError(t, err)
+	require.NotEmpty(t, records)
+	require.Equal(t, "application/json", records[0].Headers.Get("Content-Type"))
+	require.Equal(t, `{"Name":"Yes"}`, records[0].Body)
+}
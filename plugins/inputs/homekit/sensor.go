@@ -0,0 +1,278 @@
+// sensor.go
+//
+// Copyright (C) 2023-2024 Holger de Carne
+//
+// This software may be modified and distributed under the terms
+// of the MIT license.  See the LICENSE file for details.
+
+package homekit
+
+import (
+	"fmt"
+	"math"
+	"strings"
+	"sync"
+
+	"github.com/brutella/hap/accessory"
+	"github.com/brutella/hap/characteristic"
+	"github.com/brutella/hap/service"
+)
+
+const (
+	sensorTypeTemperature = "temperature"
+	sensorTypeHumidity    = "humidity"
+	sensorTypeLight       = "light"
+	sensorTypeContact     = "contact"
+)
+
+const (
+	sensorFunctionAverage = "average"
+	sensorFunctionMin     = "min"
+	sensorFunctionMax     = "max"
+	sensorFunctionSum     = "sum"
+	sensorFunctionLast    = "last"
+)
+
+var sensorTypes = map[string]bool{
+	sensorTypeTemperature: true,
+	sensorTypeHumidity:    true,
+	sensorTypeLight:       true,
+	sensorTypeContact:     true,
+}
+
+// The reading field aggregated by default per sensor type. Sensor types without a default field (humidity) are
+// not supported for derived sensors, as none of the readings provides a matching value.
+var sensorFields = map[string]string{
+	sensorTypeTemperature: "celsius",
+	sensorTypeLight:       "lux",
+	sensorTypeContact:     "active",
+}
+
+// The fields provided by the readings
+var readingFields = map[string]bool{
+	"celsius":    true,
+	"fahrenheit": true,
+	"lux":        true,
+	"hue":        true,
+	"active":     true,
+}
+
+var sensorFunctions = map[string]func(values []float64) float64{
+	sensorFunctionAverage: func(values []float64) float64 {
+		sum := 0.0
+		for _, value := range values {
+			sum += value
+		}
+		return sum / float64(len(values))
+	},
+	sensorFunctionMin: func(values []float64) float64 {
+		minValue := math.Inf(1)
+		for _, value := range values {
+			minValue = math.Min(minValue, value)
+		}
+		return minValue
+	},
+	sensorFunctionMax: func(values []float64) float64 {
+		maxValue := math.Inf(-1)
+		for _, value := range values {
+			maxValue = math.Max(maxValue, value)
+		}
+		return maxValue
+	},
+	sensorFunctionSum: func(values []float64) float64 {
+		sum := 0.0
+		for _, value := range values {
+			sum += value
+		}
+		return sum
+	},
+	sensorFunctionLast: func(values []float64) float64 {
+		return values[len(values)-1]
+	},
+}
+
+// SensorConfig defines a virtual sensor accessory derived from the received readings.
+type SensorConfig struct {
+	Name     string   `toml:"name"`
+	Type     string   `toml:"type"`
+	Function string   `toml:"function"`
+	Field    string   `toml:"field"`
+	Sources  []string `toml:"sources"`
+}
+
+// IsSensorType checks whether the given sensor type is supported by NewSensor.
+func IsSensorType(sensorType string) bool {
+	return sensorTypes[sensorType]
+}
+
+// Sensor is a virtual sensor accessory publishing values provided by the plugin.
+type Sensor struct {
+	Name      string
+	Type      string
+	Accessory *accessory.A
+	update    func(value float64)
+}
+
+// NewSensor creates a virtual sensor accessory of the given type (temperature, humidity, light or contact).
+func NewSensor(name string, sensorType string) (*Sensor, error) {
+	a := accessory.New(AccessoryInfo(name), accessory.TypeSensor)
+	var update func(value float64)
+	switch sensorType {
+	case sensorTypeTemperature:
+		s := service.NewTemperatureSensor()
+		s.CurrentTemperature.SetMinValue(-100)
+		s.CurrentTemperature.SetMaxValue(200)
+		a.AddS(s.S)
+		update = s.CurrentTemperature.SetValue
+	case sensorTypeHumidity:
+		s := service.NewHumiditySensor()
+		a.AddS(s.S)
+		update = s.CurrentRelativeHumidity.SetValue
+	case sensorTypeLight:
+		s := service.NewLightSensor()
+		a.AddS(s.S)
+		update = s.CurrentAmbientLightLevel.SetValue
+	case sensorTypeContact:
+		s := service.NewContactSensor()
+		a.AddS(s.S)
+		update = func(value float64) {
+			if value == 0 {
+				s.ContactSensorState.SetValue(characteristic.ContactSensorStateContactDetected)
+			} else {
+				s.ContactSensorState.SetValue(characteristic.ContactSensorStateContactNotDetected)
+			}
+		}
+	default:
+		return nil, fmt.Errorf("unknown sensor type '%s'", sensorType)
+	}
+	return &Sensor{
+		Name:      name,
+		Type:      sensorType,
+		Accessory: a,
+		update:    update,
+	}, nil
+}
+
+// Update publishes a new sensor value. Values outside the sensor's range are clamped. A contact sensor
+// reports contact for the value 0 and no contact for any other value.
+func (sensor *Sensor) Update(value float64) {
+	sensor.update(value)
+}
+
+type derivedSensor struct {
+	*Sensor
+	field     string
+	aggregate func(values []float64) float64
+	sources   []string
+	values    map[string]float64
+	updates   []string
+	mutex     sync.Mutex
+}
+
+func newDerivedSensor(sensorConfig SensorConfig) (*derivedSensor, error) {
+	virtualSensor, err := NewSensor(sensorConfig.Name, sensorConfig.Type)
+	if err != nil {
+		return nil, err
+	}
+	function := sensorConfig.Function
+	if function == "" {
+		function = sensorFunctionAverage
+	}
+	aggregate, ok := sensorFunctions[function]
+	if !ok {
+		return nil, fmt.Errorf("unknown sensor function '%s'", function)
+	}
+	field := sensorConfig.Field
+	if field == "" {
+		field = sensorFields[sensorConfig.Type]
+	}
+	return &derivedSensor{
+		Sensor:    virtualSensor,
+		field:     field,
+		aggregate: aggregate,
+		sources:   sensorConfig.Sources,
+		values:    make(map[string]float64),
+	}, nil
+}
+
+// isSource checks whether the reading with the given name, room and characteristic is one of the sensor's
+// sources. A source matches all readings whose name_room_characteristic key equals the source or starts with
+// the source followed by an underscore. Matching the joined key (instead of the single parts) also supports
+// names and rooms containing underscores.
+func (sensor *derivedSensor) isSource(name string, room string, characteristic string) bool {
+	key := readingKey(name, room, characteristic)
+	for _, source := range sensor.sources {
+		if key == source || strings.HasPrefix(key, source+"_") {
+			return true
+		}
+	}
+	return false
+}
+
+func readingKey(name string, room string, characteristic string) string {
+	return name + "_" + room + "_" + characteristic
+}
+
+// record records the given reading and publishes the newly aggregated sensor value.
+func (sensor *derivedSensor) record(name string, room string, characteristic string, fields map[string]interface{}) (float64, bool) {
+	if !sensor.isSource(name, room, characteristic) {
+		return 0, false
+	}
+	value, ok := fieldValue(fields[sensor.field])
+	if !ok {
+		return 0, false
+	}
+	key := readingKey(name, room, characteristic)
+	sensor.mutex.Lock()
+	defer sensor.mutex.Unlock()
+	sensor.values[key] = value
+	// keep the update order for the last function
+	for i, update := range sensor.updates {
+		if update == key {
+			sensor.updates = append(sensor.updates[:i], sensor.updates[i+1:]...)
+			break
+		}
+	}
+	sensor.updates = append(sensor.updates, key)
+	values := make([]float64, 0, len(sensor.updates))
+	for _, update := range sensor.updates {
+		values = append(values, sensor.values[update])
+	}
+	aggregated := sensor.aggregate(values)
+	sensor.Update(aggregated)
+	return aggregated, true
+}
+
+func fieldValue(field interface{}) (float64, bool) {
+	switch value := field.(type) {
+	case float64:
+		return value, true
+	case int:
+		return float64(value), true
+	}
+	return 0, false
+}
+
+func (plugin *HomeKit) setupSensors() ([]*accessory.A, error) {
+	plugin.sensors = make([]*derivedSensor, 0, len(plugin.Sensors))
+	sensorAccessories := make([]*accessory.A, 0, len(plugin.Sensors))
+	for _, sensorConfig := range plugin.Sensors {
+		plugin.Log.Infof("Setting up sensor accessory: %s (type: %s, sources: %s)", sensorConfig.Name, sensorConfig.Type, strings.Join(sensorConfig.Sources, ", "))
+		sensor, err := newDerivedSensor(sensorConfig)
+		if err != nil {
+			return nil, err
+		}
+		plugin.sensors = append(plugin.sensors, sensor)
+		sensorAccessories = append(sensorAccessories, sensor.Accessory)
+	}
+	return sensorAccessories, nil
+}
+
+func (plugin *HomeKit) updateSensors(name string, room string, characteristic string, fields map[string]interface{}) {
+	for _, sensor := range plugin.sensors {
+		value, updated := sensor.record(name, room, characteristic, fields)
+		if updated && plugin.Debug {
+			plugin.Log.Infof("Updated sensor %s: %v", sensor.Name, value)
+		}
+	}
+}
@@ -0,0 +1,99 @@
+// sensor_test.go
+//
+// # Copyright (C) 2023-2024 Holger de Carne
+//
+// This software may be modified and distributed under the terms
+// of the MIT license.  See the LICENSE file for details.
+package homekit
+
+import (
+	"testing"
+	"time"
+
+	"github.com/brutella/hap/accessory"
+	"github.com/brutella/hap/characteristic"
+	"github.com/influxdata/telegraf/testutil"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewSensor(t *testing.T) {
+	sensorValues := map[string][]float64{
+		sensorTypeTemperature: {-12.5, -12.5},
+		sensorTypeHumidity:    {120, 100},
+		sensorTypeLight:       {0, 0.0001},
+		sensorTypeContact:     {2, float64(characteristic.ContactSensorStateContactNotDetected)},
+	}
+	for sensorType, values := range sensorValues {
+		require.True(t, IsSensorType(sensorType))
+		sensor, err := NewSensor("Sensor", sensorType)
+		require.NoError(t, err)
+		require.Equal(t, accessory.TypeSensor, sensor.Accessory.Type)
+		sensor.Update(values[0])
+		c := sensor.Accessory.Ss[1].Cs[0]
+		require.EqualValues(t, values[1], c.Val, sensorType)
+	}
+	require.False(t, IsSensorType("pressure"))
+	_, err := NewSensor("Sensor", "pressure")
+	require.Error(t, err)
+}
+
+func TestDerivedSensors(t *testing.T) {
+	plugin := NewHomeKit()
+	plugin.MonitorAccessoryName = "TestMonitor"
+	plugin.Sensors = []SensorConfig{
+		{Name: "Room Temperature", Type: "temperature", Sources: []string{"Thermometer1_Room", "Thermometer2_Room"}},
+		{Name: "Max Temperature", Type: "temperature", Function: "max", Sources: []string{"Thermometer1", "Thermometer2"}},
+		{Name: "Last Temperature", Type: "temperature", Function: "last", Field: "celsius", Sources: []string{"Thermometer1", "Thermometer2"}},
+		{Name: "Any Motion", Type: "contact", Function: "sum", Sources: []string{"Motion1_Room_Motion", "Motion2"}},
+	}
+	plugin.Log = createDummyLogger()
+	require.NoError(t, plugin.Init())
+
+	monitorAccessory, bridgedAccessories, err := plugin.setupAccessories()
+	require.NoError(t, err)
+	require.Equal(t, accessory.TypeBridge, monitorAccessory.Type)
+	require.Equal(t, accessory.TypeBridge, plugin.accessoryCategory())
+	require.Len(t, bridgedAccessories, 5)
+	require.Equal(t, accessory.TypeSwitch, bridgedAccessories[0].Type)
+	require.Len(t, plugin.sensors, 4)
+
+	acc := &testutil.Accumulator{}
+
+	report := plugin.processData(acc, map[string]string{
+		"Thermometer1_Room":        "20.0 °C",
+		"Thermometer2_Room":        "71.6 °F",
+		"Thermometer3_Room":        "30.0 °C",
+		"Motion1_Room_Motion":      "No",
+		"Motion1_Room_Temperature": "10.0 °C",
+	}, time.Now())
+	require.Equal(t, 5, report.Accepted)
+	require.InDelta(t, 21.0, derivedSensorValue(plugin.sensors[0]), 0.01)
+	require.InDelta(t, 22.0, derivedSensorValue(plugin.sensors[1]), 0.01)
+	require.InDelta(t, 22.0, derivedSensorValue(plugin.sensors[2]), 0.01)
+	require.EqualValues(t, characteristic.ContactSensorStateContactDetected, derivedSensorValue(plugin.sensors[3]))
+
+	plugin.processData(acc, map[string]string{
+		"Thermometer1_Room": "24.0 °C",
+		"Motion2":           "Yes",
+	}, time.Now())
+	require.InDelta(t, 23.0, derivedSensorValue(plugin.sensors[0]), 0.01)
+	require.InDelta(t, 24.0, derivedSensorValue(plugin.sensors[1]), 0.01)
+	require.InDelta(t, 24.0, derivedSensorValue(plugin.sensors[2]), 0.01)
+	require.EqualValues(t, characteristic.ContactSensorStateContactNotDetected, derivedSensorValue(plugin.sensors[3]))
+}
+
+func TestDerivedSensorSources(t *testing.T) {
+	sensor, err := newDerivedSensor(SensorConfig{Name: "Sensor", Type: "temperature", Sources: []string{"living_room_Temperature", "Thermo_Room"}})
+	require.NoError(t, err)
+	require.True(t, sensor.isSource("living_room", "Temperature", "generic"))
+	require.True(t, sensor.isSource("living", "room", "Temperature"))
+	require.True(t, sensor.isSource("Thermo", "Room", "Temperature"))
+	require.True(t, sensor.isSource("Thermo_Room", "undefined", "generic"))
+	require.False(t, sensor.isSource("living_room", "Kitchen", "Temperature"))
+	require.False(t, sensor.isSource("Thermo", "Room2", "Temperature"))
+	require.False(t, sensor.isSource("Thermometer", "Room", "Temperature"))
+}
+
+func derivedSensorValue(sensor *derivedSensor) interface{} {
+	return sensor.Accessory.Ss[1].Cs[0].Val
+}
@@ -0,0 +1,160 @@
+// setup.go
+//
+// Copyright (C) 2023-2024 Holger de Carne
+//
+// This software may be modified and distributed under the terms
+// of the MIT license.  See the LICENSE file for details.
+
+package homekit
+
+import (
+	"crypto/rand"
+	"fmt"
+	"math/big"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/brutella/hap"
+	"github.com/skip2/go-qrcode"
+)
+
+const setupIDKey = "setupid"
+const setupIDAlphabet = "0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZ"
+const setupIDLength = 4
+const setupURIPrefix = "X-HM://"
+const setupFlagIP = 1 << 28
+const setupPNGSize = 256
+
+func loadOrCreateSetupID(store hap.Store) (string, error) {
+	setupIDBytes, err := store.Get(setupIDKey)
+	if err == nil && isValidSetupID(string(setupIDBytes)) {
+		return string(setupIDBytes), nil
+	}
+	setupID, err := randomString(setupIDAlphabet, setupIDLength)
+	if err != nil {
+		return "", err
+	}
+	err = store.Set(setupIDKey, []byte(setupID))
+	if err != nil {
+		return "", err
+	}
+	return setupID, nil
+}
+
+func isValidSetupID(setupID string) bool {
+	if len(setupID) != setupIDLength {
+		return false
+	}
+	for _, c := range setupID {
+		if !strings.ContainsRune(setupIDAlphabet, c) {
+			return false
+		}
+	}
+	return true
+}
+
+func randomString(alphabet string, length int) (string, error) {
+	var builder strings.Builder
+	max := big.NewInt(int64(len(alphabet)))
+	for i := 0; i < length; i++ {
+		n, err := rand.Int(rand.Reader, max)
+		if err != nil {
+			return "", err
+		}
+		builder.WriteByte(alphabet[n.Int64()])
+	}
+	return builder.String(), nil
+}
+
+func setupURI(category byte, pin string, setupID string) (string, error) {
+	setupCode, err := strconv.ParseUint(pin, 10, 27)
+	if err != nil {
+		return "", fmt.Errorf("invalid pin '%s' (cause: %v)", pin, err)
+	}
+	payload := uint64(category)<<31 | setupFlagIP | setupCode
+	encodedPayload := strings.ToUpper(strconv.FormatUint(payload, 36))
+	return setupURIPrefix + fmt.Sprintf("%09s", encodedPayload) + setupID, nil
+}
+
+func formatPin(pin string) string {
+	if len(pin) != 8 {
+		return pin
+	}
+	return pin[:3] + "-" + pin[3:5] + "-" + pin[5:]
+}
+
+func setupQRCode(uri string) (*qrcode.QRCode, error) {
+	return qrcode.New(uri, qrcode.Medium)
+}
+
+func setupSVG(code *qrcode.QRCode) string {
+	bitmap := code.Bitmap()
+	var svg strings.Builder
+	fmt.Fprintf(&svg, `<svg xmlns="http://www.w3.org/2000/svg" viewBox="0 0 %d %d" shape-rendering="crispEdges">`, len(bitmap), len(bitmap))
+	fmt.Fprintf(&svg, `<rect width="%d" height="%d" fill="#fff"/><path fill="#000" d="`, len(bitmap), len(bitmap))
+	for y, row := range bitmap {
+		for x, set := range row {
+			if set {
+				fmt.Fprintf(&svg, "M%d %dh1v1h-1z", x, y)
+			}
+		}
+	}
+	svg.WriteString(`"/></svg>`)
+	return svg.String()
+}
+
+func (plugin *HomeKit) logSetupCode() {
+	code, err := setupQRCode(plugin.setupURI)
+	if err != nil {
+		plugin.Log.Warnf("Failed to generate setup code (cause: %v)", err)
+		return
+	}
+	plugin.Log.Infof("Setup URI for monitor accessory '%s': %s (pin: %s)\n%s", plugin.MonitorAccessoryName, plugin.setupURI, formatPin(plugin.accessoryPin), code.ToSmallString(false))
+}
+
+// isSetupCodeServed checks whether the setup code may be served via the status page. As the setup code allows
+// anybody to pair the monitor accessory, it is only served if the allowed hosts are configured explicitly.
+func (plugin *HomeKit) isSetupCodeServed() bool {
+	return len(plugin.MonitorHosts) > 0
+}
+
+func (plugin *HomeKit) setupCode(res http.ResponseWriter, req *http.Request) {
+	if !plugin.isAllowedMonitorHost(req.RemoteAddr) {
+		plugin.Log.Warnf("Unallowed status host: %s", req.RemoteAddr)
+		res.WriteHeader(http.StatusForbidden)
+		return
+	}
+	if !plugin.isSetupCodeServed() {
+		plugin.Log.Warnf("Unallowed setup code request: %s (no monitor_hosts configured)", req.RemoteAddr)
+		res.WriteHeader(http.StatusForbidden)
+		return
+	}
+	if req.Method != http.MethodGet {
+		plugin.Log.Warnf("Invalid method: %s", req.Method)
+		res.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	code, err := setupQRCode(plugin.setupURI)
+	if err != nil {
+		plugin.Log.Warnf("Failed to generate setup code (cause: %v)", err)
+		res.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	switch req.URL.Path {
+	case plugin.StatusPath + "/setup.png":
+		png, err := code.PNG(setupPNGSize)
+		if err != nil {
+			plugin.Log.Warnf("Failed to generate setup code (cause: %v)", err)
+			res.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		res.Header().Set("Content-Type", "image/png")
+		res.Write(png)
+	case plugin.StatusPath + "/setup.svg":
+		res.Header().Set("Content-Type", "image/svg+xml")
+		res.Write([]byte(setupSVG(code)))
+	default:
+		http.NotFound(res, req)
+	}
+}
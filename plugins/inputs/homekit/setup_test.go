@@ -0,0 +1,47 @@
+// setup_test.go
+//
+// # Copyright (C) 2023-2024 Holger de Carne
+//
+// This software may be modified and distributed under the terms
+// of the MIT license.  See the LICENSE file for details.
+package homekit
+
+import (
+	"testing"
+
+	"github.com/brutella/hap"
+	"github.com/brutella/hap/accessory"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSetupURI(t *testing.T) {
+	uri, err := setupURI(accessory.TypeSwitch, "03145154", "1QJ8")
+	require.NoError(t, err)
+	require.Equal(t, "X-HM://0080M54UA1QJ8", uri)
+	uri, err = setupURI(accessory.TypeProgrammableSwitch, "03145154", "1QJ8")
+	require.NoError(t, err)
+	require.Equal(t, "X-HM://00EX81BR61QJ8", uri)
+	uri, err = setupURI(accessory.TypeBridge, "03145154", "1QJ8")
+	require.NoError(t, err)
+	require.Equal(t, "X-HM://0023ISYWY1QJ8", uri)
+	_, err = setupURI(accessory.TypeSwitch, "abc", "1QJ8")
+	require.Error(t, err)
+}
+
+func TestLoadOrCreateSetupID(t *testing.T) {
+	store := hap.NewMemStore()
+	setupID1, err := loadOrCreateSetupID(store)
+	require.NoError(t, err)
+	require.True(t, isValidSetupID(setupID1))
+	setupID2, err := loadOrCreateSetupID(store)
+	require.NoError(t, err)
+	require.Equal(t, setupID1, setupID2)
+}
+
+func TestSetupSVG(t *testing.T) {
+	code, err := setupQRCode("X-HM://0080M54UA1QJ8")
+	require.NoError(t, err)
+	svg := setupSVG(code)
+	require.Contains(t, svg, "<svg")
+	require.Contains(t, svg, "</svg>")
+}
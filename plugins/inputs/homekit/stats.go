@@ -0,0 +1,215 @@
+// stats.go
+//
+// Copyright (C) 2023-2024 Holger de Carne
+//
+// This software may be modified and distributed under the terms
+// of the MIT license.  See the LICENSE file for details.
+
+package homekit
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// The TCP socket tables and the state of an established connection (Linux only)
+var tcpSocketTables = []string{"/proc/net/tcp", "/proc/net/tcp6"}
+
+const tcpStateEstablished = "01"
+
+type statusCounter struct {
+	counts map[int]int64
+	mutex  sync.Mutex
+}
+
+func (counter *statusCounter) count(statusCode int) {
+	counter.mutex.Lock()
+	defer counter.mutex.Unlock()
+	if counter.counts == nil {
+		counter.counts = make(map[int]int64)
+	}
+	counter.counts[statusCode]++
+}
+
+func (counter *statusCounter) addFields(fields map[string]interface{}) {
+	counter.mutex.Lock()
+	defer counter.mutex.Unlock()
+	for statusCode, count := range counter.counts {
+		fields[fmt.Sprintf("requests_%d", statusCode)] = count
+	}
+}
+
+type statusRecorder struct {
+	http.ResponseWriter
+	statusCode int
+}
+
+func (recorder *statusRecorder) WriteHeader(statusCode int) {
+	recorder.statusCode = statusCode
+	recorder.ResponseWriter.WriteHeader(statusCode)
+}
+
+// countRequests counts the handled requests by status code and accumulates their processing time.
+func (plugin *HomeKit) countRequests(handler http.Handler) http.Handler {
+	return http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		start := time.Now()
+		recorder := &statusRecorder{ResponseWriter: res, statusCode: http.StatusOK}
+		handler.ServeHTTP(recorder, req)
+		processingTime := time.Since(start).Nanoseconds()
+		plugin.processingTime.Add(processingTime)
+		plugin.lastProcessingTime.Store(processingTime)
+		plugin.requestCounts.count(recorder.statusCode)
+	})
+}
+
+// remoteSet tracks the remote addresses of the connections served by the plugin's own handlers on the HAP server
+// port, so these connections can be excluded when counting the HAP connections.
+type remoteSet struct {
+	remotes map[string]struct{}
+	mutex   sync.Mutex
+}
+
+func (set *remoteSet) add(remote string) {
+	set.mutex.Lock()
+	defer set.mutex.Unlock()
+	if set.remotes == nil {
+		set.remotes = make(map[string]struct{})
+	}
+	set.remotes[normalizeRemote(remote)] = struct{}{}
+}
+
+func (set *remoteSet) contains(remote string) bool {
+	set.mutex.Lock()
+	defer set.mutex.Unlock()
+	_, ok := set.remotes[remote]
+	return ok
+}
+
+// retain drops all remote addresses not contained in the given (currently established) remote addresses.
+func (set *remoteSet) retain(established map[string]struct{}) {
+	set.mutex.Lock()
+	defer set.mutex.Unlock()
+	for remote := range set.remotes {
+		if _, ok := established[remote]; !ok {
+			delete(set.remotes, remote)
+		}
+	}
+}
+
+func normalizeRemote(remote string) string {
+	host, port, err := net.SplitHostPort(remote)
+	if err != nil {
+		return remote
+	}
+	host, _, _ = strings.Cut(host, "%")
+	ip := net.ParseIP(host)
+	if ip == nil {
+		return remote
+	}
+	return net.JoinHostPort(ip.String(), port)
+}
+
+// trackRemotes records the remote address of every request served by the given handler via the HAP server.
+func (plugin *HomeKit) trackRemotes(handler http.Handler) http.Handler {
+	return http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		plugin.monitorRemotes.add(req.RemoteAddr)
+		handler.ServeHTTP(res, req)
+	})
+}
+
+// hapConnections approximates the number of established connections to the HAP server by examining the system's
+// TCP socket tables, as the HAP library does not expose its connections. Connections used for the plugin's own
+// requests (monitor, status and metrics) on the HAP server port are excluded as soon as they have been served.
+// Other clients connected to the HAP server port are counted as well, hence the result is a best-effort value only.
+// Only supported on systems providing /proc/net/tcp or /proc/net/tcp6 (Linux).
+func (plugin *HomeKit) hapConnections() (int, error) {
+	_, port, err := net.SplitHostPort(plugin.Address)
+	if err != nil {
+		return 0, err
+	}
+	portNumber, err := strconv.ParseUint(port, 10, 16)
+	if err != nil {
+		return 0, err
+	}
+	established := make(map[string]struct{})
+	tables := 0
+	for _, tcpSocketTable := range tcpSocketTables {
+		err = establishedSockets(tcpSocketTable, uint16(portNumber), established)
+		if errors.Is(err, os.ErrNotExist) {
+			continue
+		} else if err != nil {
+			return 0, err
+		}
+		tables++
+	}
+	if tables == 0 {
+		return 0, errors.New("no TCP socket table available")
+	}
+	plugin.monitorRemotes.retain(established)
+	connections := 0
+	for remote := range established {
+		if !plugin.monitorRemotes.contains(remote) {
+			connections++
+		}
+	}
+	return connections, nil
+}
+
+// establishedSockets collects the remote addresses of all established sockets with the given local port.
+func establishedSockets(tcpSocketTable string, localPort uint16, established map[string]struct{}) error {
+	file, err := os.Open(tcpSocketTable)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		// sl local_address rem_address st ...
+		columns := strings.Fields(scanner.Text())
+		if len(columns) <= 3 || columns[3] != tcpStateEstablished {
+			continue
+		}
+		_, port, err := parseSocketAddress(columns[1])
+		if err != nil || port != localPort {
+			continue
+		}
+		remoteIP, remotePort, err := parseSocketAddress(columns[2])
+		if err != nil {
+			continue
+		}
+		established[net.JoinHostPort(remoteIP.String(), strconv.Itoa(int(remotePort)))] = struct{}{}
+	}
+	return scanner.Err()
+}
+
+// parseSocketAddress parses a socket table address (<hex ip>:<hex port>). The IP is made up of 32 bit words in
+// host byte order, the port is in network byte order.
+func parseSocketAddress(address string) (net.IP, uint16, error) {
+	hexIP, hexPort, ok := strings.Cut(address, ":")
+	if !ok {
+		return nil, 0, fmt.Errorf("invalid socket address '%s'", address)
+	}
+	rawIP, err := hex.DecodeString(hexIP)
+	if err != nil || (len(rawIP) != net.IPv4len && len(rawIP) != net.IPv6len) {
+		return nil, 0, fmt.Errorf("invalid socket address '%s'", address)
+	}
+	port, err := strconv.ParseUint(hexPort, 16, 16)
+	if err != nil {
+		return nil, 0, fmt.Errorf("invalid socket address '%s'", address)
+	}
+	ip := make(net.IP, len(rawIP))
+	for word := 0; word < len(rawIP); word += 4 {
+		binary.BigEndian.PutUint32(ip[word:], binary.NativeEndian.Uint32(rawIP[word:]))
+	}
+	return ip, uint16(port), nil
+}
@@ -0,0 +1,110 @@
+// stats_test.go
+//
+// # Copyright (C) 2023-2024 Holger de Carne
+//
+// This software may be modified and distributed under the terms
+// of the MIT license.  See the LICENSE file for details.
+package homekit
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+const testTCPSocketTable = `  sl  local_address rem_address   st tx_queue rx_queue tr tm->when retrnsmt   uid  timeout inode
+   0: 00000000:1F41 00000000:0000 0A 00000000:00000000 00:00000000 00000000     0        0 1 1 0000000000000000 100 0 0 10 0
+   1: 0100007F:1F41 0100007F:D2F0 01 00000000:00000000 00:00000000 00000000     0        0 2 1 0000000000000000 20 4 30 10 -1
+   2: 0100007F:D2F0 0100007F:1F41 01 00000000:00000000 00:00000000 00000000     0        0 3 1 0000000000000000 20 4 30 10 -1
+   3: 0100007F:1F41 0100007F:D2F2 06 00000000:00000000 00:00000000 00000000     0        0 0 3 0000000000000000
+   4: 0100007F:1F41 0100007F:D2F4 01 00000000:00000000 00:00000000 00000000     0        0 4 1 0000000000000000 20 4 30 10 -1
+`
+
+const testTCP6SocketTable = `  sl  local_address                         remote_address                        st tx_queue rx_queue tr tm->when retrnsmt   uid  timeout inode
+   0: 00000000000000000000000001000000:1F41 00000000000000000000000001000000:D2F6 01 00000000:00000000 00:00000000 00000000     0        0 5 1 0000000000000000 20 4 30 10 -1
+   1: 0000000000000000FFFF00000100007F:1F41 0000000000000000FFFF00000100007F:D2F8 01 00000000:00000000 00:00000000 00000000     0        0 6 1 0000000000000000 20 4 30 10 -1
+`
+
+func TestEstablishedSockets(t *testing.T) {
+	tcpSocketTable := filepath.Join(t.TempDir(), "tcp")
+	require.NoError(t, os.WriteFile(tcpSocketTable, []byte(testTCPSocketTable), 0600))
+	established := make(map[string]struct{})
+	require.NoError(t, establishedSockets(tcpSocketTable, 8001, established))
+	require.Equal(t, map[string]struct{}{"127.0.0.1:54000": {}, "127.0.0.1:54004": {}}, established)
+	err := establishedSockets(filepath.Join(t.TempDir(), "nonexistent"), 8001, established)
+	require.ErrorIs(t, err, os.ErrNotExist)
+}
+
+func TestHAPConnections(t *testing.T) {
+	tempDir := t.TempDir()
+	tcpSocketTable := filepath.Join(tempDir, "tcp")
+	tcp6SocketTable := filepath.Join(tempDir, "tcp6")
+	require.NoError(t, os.WriteFile(tcpSocketTable, []byte(testTCPSocketTable), 0600))
+	require.NoError(t, os.WriteFile(tcp6SocketTable, []byte(testTCP6SocketTable), 0600))
+	defer func(tables []string) { tcpSocketTables = tables }(tcpSocketTables)
+	plugin := NewHomeKit()
+	plugin.Address = "localhost:8001"
+
+	tcpSocketTables = []string{tcpSocketTable, tcp6SocketTable}
+	connections, err := plugin.hapConnections()
+	require.NoError(t, err)
+	require.Equal(t, 4, connections)
+
+	// requests served by the plugin itself are excluded
+	handler := plugin.trackRemotes(http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {}))
+	for _, remote := range []string{"127.0.0.1:54004", "[::1]:54006", "127.0.0.1:54010"} {
+		req := httptest.NewRequest(http.MethodGet, "/status", nil)
+		req.RemoteAddr = remote
+		handler.ServeHTTP(httptest.NewRecorder(), req)
+	}
+	connections, err = plugin.hapConnections()
+	require.NoError(t, err)
+	require.Equal(t, 2, connections)
+	require.False(t, plugin.monitorRemotes.contains("127.0.0.1:54010"))
+
+	// missing tables are skipped
+	tcpSocketTables = []string{tcpSocketTable, filepath.Join(tempDir, "nonexistent")}
+	connections, err = plugin.hapConnections()
+	require.NoError(t, err)
+	require.Equal(t, 1, connections)
+
+	tcpSocketTables = []string{filepath.Join(tempDir, "nonexistent")}
+	_, err = plugin.hapConnections()
+	require.Error(t, err)
+}
+
+func TestParseSocketAddress(t *testing.T) {
+	ip, port, err := parseSocketAddress("0100007F:1F41")
+	require.NoError(t, err)
+	require.Equal(t, "127.0.0.1", ip.String())
+	require.Equal(t, uint16(8001), port)
+	ip, port, err = parseSocketAddress("0000000000000000FFFF00000100007F:D2F8")
+	require.NoError(t, err)
+	require.Equal(t, "127.0.0.1", ip.String())
+	require.Equal(t, uint16(54008), port)
+	_, _, err = parseSocketAddress("0100007F")
+	require.Error(t, err)
+	_, _, err = parseSocketAddress("7F:1F41")
+	require.Error(t, err)
+}
+
+func TestCountRequests(t *testing.T) {
+	plugin := NewHomeKit()
+	handler := plugin.countRequests(http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		if req.Method != http.MethodPut {
+			res.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		res.Write([]byte("OK"))
+	}))
+	for _, method := range []string{http.MethodPut, http.MethodPut, http.MethodPost} {
+		handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(method, "/monitor", nil))
+	}
+	fields := make(map[string]interface{})
+	plugin.requestCounts.addFields(fields)
+	require.Equal(t, map[string]interface{}{"requests_200": int64(2), "requests_400": int64(1)}, fields)
+}
@@ -0,0 +1,223 @@
+// status.go
+//
+// Copyright (C) 2023-2024 Holger de Carne
+//
+// This software may be modified and distributed under the terms
+// of the MIT license.  See the LICENSE file for details.
+
+package homekit
+
+import (
+	_ "embed"
+	"encoding/json"
+	"html/template"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/brutella/hap"
+)
+
+const statusErrorsLimit = 20
+
+//go:embed status.html
+var statusHTML string
+
+var statusTemplate = template.Must(template.New("status").Parse(statusHTML))
+
+type statusReading struct {
+	Name           string                 `json:"name"`
+	Room           string                 `json:"room"`
+	Characteristic string                 `json:"characteristic"`
+	Measurement    string                 `json:"measurement"`
+	Fields         map[string]interface{} `json:"fields"`
+	Time           time.Time              `json:"time"`
+}
+
+type statusError struct {
+	Time   time.Time `json:"time"`
+	Remote string    `json:"remote"`
+	Key    string    `json:"key,omitempty"`
+	Value  string    `json:"value,omitempty"`
+	Error  string    `json:"error"`
+}
+
+type statusController struct {
+	Name  string `json:"name"`
+	Admin bool   `json:"admin"`
+}
+
+type statusReport struct {
+	Model          string             `json:"model"`
+	Version        string             `json:"version"`
+	Monitor        string             `json:"monitor"`
+	SetupURI       string             `json:"setup_uri,omitempty"`
+	SetupCode      string             `json:"setup_code,omitempty"`
+	SetupSVG       template.HTML      `json:"-"`
+	Paired         bool               `json:"paired"`
+	Controllers    []statusController `json:"controllers"`
+	LastTrigger    *time.Time         `json:"last_trigger,omitempty"`
+	LastPush       *time.Time         `json:"last_push,omitempty"`
+	LastPushRemote string             `json:"last_push_remote,omitempty"`
+	Readings       []*statusReading   `json:"readings"`
+	Errors         []*statusError     `json:"errors"`
+}
+
+type pluginStatus struct {
+	lastTrigger    time.Time
+	lastPush       time.Time
+	lastPushRemote string
+	readings       map[string]*statusReading
+	errors         []*statusError
+	pushed         chan struct{}
+	mutex          sync.Mutex
+}
+
+func newPluginStatus() *pluginStatus {
+	return &pluginStatus{readings: make(map[string]*statusReading), pushed: make(chan struct{})}
+}
+
+// pushNotify returns a channel which is closed as soon as the next push has been recorded.
+func (status *pluginStatus) pushNotify() <-chan struct{} {
+	status.mutex.Lock()
+	defer status.mutex.Unlock()
+	return status.pushed
+}
+
+func (status *pluginStatus) recordTrigger(now time.Time) {
+	status.mutex.Lock()
+	defer status.mutex.Unlock()
+	status.lastTrigger = now
+}
+
+func (status *pluginStatus) recordPush(now time.Time, remote string, report *dataReport) {
+	status.mutex.Lock()
+	defer status.mutex.Unlock()
+	status.lastPush = now
+	status.lastPushRemote = remote
+	close(status.pushed)
+	status.pushed = make(chan struct{})
+	for _, result := range report.Results {
+		if result.Error != "" {
+			status.appendError(&statusError{Time: now, Remote: remote, Key: result.Key, Value: result.Value, Error: result.Error})
+			continue
+		}
+		status.readings[result.Name+"/"+result.Room+"/"+result.Characteristic] = &statusReading{
+			Name:           result.Name,
+			Room:           result.Room,
+			Characteristic: result.Characteristic,
+			Measurement:    result.Measurement,
+			Fields:         result.Fields,
+			Time:           now,
+		}
+	}
+}
+
+func (status *pluginStatus) recordError(now time.Time, remote string, err error) {
+	status.mutex.Lock()
+	defer status.mutex.Unlock()
+	status.appendError(&statusError{Time: now, Remote: remote, Error: err.Error()})
+}
+
+func (status *pluginStatus) appendError(statusError *statusError) {
+	status.errors = append(status.errors, statusError)
+	if len(status.errors) > statusErrorsLimit {
+		status.errors = status.errors[len(status.errors)-statusErrorsLimit:]
+	}
+}
+
+// sortedReadings lists the last readings sorted by room, name and characteristic (status must be locked).
+func (status *pluginStatus) sortedReadings() []*statusReading {
+	readings := make([]*statusReading, 0, len(status.readings))
+	for _, reading := range status.readings {
+		readings = append(readings, reading)
+	}
+	sort.Slice(readings, func(i, j int) bool {
+		if readings[i].Room != readings[j].Room {
+			return readings[i].Room < readings[j].Room
+		}
+		if readings[i].Name != readings[j].Name {
+			return readings[i].Name < readings[j].Name
+		}
+		return readings[i].Characteristic < readings[j].Characteristic
+	})
+	return readings
+}
+
+func (plugin *HomeKit) statusReport() *statusReport {
+	report := &statusReport{
+		Model:       model,
+		Version:     firmware,
+		Monitor:     plugin.MonitorAccessoryName,
+		Controllers: make([]statusController, 0),
+	}
+	pairings, err := storePairings(plugin.store)
+	if err != nil {
+		plugin.Log.Warnf("Failed to read pairings (cause: %v)", err)
+	}
+	for _, pairing := range pairings {
+		report.Controllers = append(report.Controllers, statusController{Name: pairing.Name, Admin: pairing.Permission == hap.PermissionAdmin})
+	}
+	report.Paired = len(report.Controllers) > 0
+	if plugin.isSetupCodeServed() {
+		report.SetupURI = plugin.setupURI
+		report.SetupCode = formatPin(plugin.accessoryPin)
+		code, err := setupQRCode(plugin.setupURI)
+		if err != nil {
+			plugin.Log.Warnf("Failed to generate setup code (cause: %v)", err)
+		} else {
+			report.SetupSVG = template.HTML(setupSVG(code))
+		}
+	}
+	status := plugin.status
+	status.mutex.Lock()
+	defer status.mutex.Unlock()
+	if !status.lastTrigger.IsZero() {
+		lastTrigger := status.lastTrigger
+		report.LastTrigger = &lastTrigger
+	}
+	if !status.lastPush.IsZero() {
+		lastPush := status.lastPush
+		report.LastPush = &lastPush
+		report.LastPushRemote = status.lastPushRemote
+	}
+	report.Readings = status.sortedReadings()
+	report.Errors = make([]*statusError, len(status.errors))
+	for i, statusError := range status.errors {
+		report.Errors[len(status.errors)-1-i] = statusError
+	}
+	return report
+}
+
+func (plugin *HomeKit) statusPage(res http.ResponseWriter, req *http.Request) {
+	if !plugin.isAllowedMonitorHost(req.RemoteAddr) {
+		plugin.Log.Warnf("Unallowed status host: %s", req.RemoteAddr)
+		res.WriteHeader(http.StatusForbidden)
+		return
+	}
+	if req.URL.Path != plugin.StatusPath {
+		http.NotFound(res, req)
+		return
+	}
+	if req.Method != http.MethodGet {
+		plugin.Log.Warnf("Invalid method: %s", req.Method)
+		res.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	report := plugin.statusReport()
+	if req.URL.Query().Get("format") == "json" || strings.Contains(req.Header.Get("Accept"), "application/json") {
+		res.Header().Set("Content-Type", "application/json")
+		err := json.NewEncoder(res).Encode(report)
+		if err != nil {
+			plugin.Log.Warnf("Failed to send status report (cause: %v)", err)
+		}
+		return
+	}
+	res.Header().Set("Content-Type", "text/html; charset=utf-8")
+	err := statusTemplate.Execute(res, report)
+	if err != nil {
+		plugin.Log.Warnf("Failed to send status page (cause: %v)", err)
+	}
+}
@@ -0,0 +1,148 @@
+// status_test.go
+//
+// # Copyright (C) 2023-2024 Holger de Carne
+//
+// This software may be modified and distributed under the terms
+// of the MIT license.  See the LICENSE file for details.
+package homekit
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"testing"
+
+	"github.com/influxdata/telegraf/testutil"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStatusPage(t *testing.T) {
+	address := freeAddress(t)
+
+	plugin := NewHomeKit()
+	plugin.Address = address
+	plugin.HAPStorePath = "../../../build/.hap"
+	plugin.MonitorAccessoryName = "TestMonitor"
+	plugin.MonitorHosts = []string{"localhost"}
+	plugin.StatusPath = "/status"
+	plugin.Log = createDummyLogger()
+
+	acc := &testutil.Accumulator{}
+
+	defer plugin.Stop()
+	require.NoError(t, plugin.Start(acc))
+	require.NoError(t, plugin.Gather(acc))
+	waitForAddress(t, address)
+
+	putJson(t, address, `{
+		"Name_Room": "12.3 °C",
+		"Name_Room_Light": "Maybe"
+	}`)
+
+	rsp, err := http.Get(fmt.Sprintf("http://%s/status?format=json", address))
+	require.NoError(t, err)
+	defer rsp.Body.Close()
+	require.Equal(t, http.StatusOK, rsp.StatusCode)
+	report := &statusReport{}
+	require.NoError(t, json.NewDecoder(rsp.Body).Decode(report))
+	require.Equal(t, "TestMonitor", report.Monitor)
+	require.Regexp(t, "^X-HM://[0-9A-Z]{13}$", report.SetupURI)
+	require.Equal(t, "001-02-003", report.SetupCode)
+	require.Nil(t, report.LastTrigger)
+	require.False(t, report.Paired)
+	require.NotNil(t, report.LastPush)
+	require.Len(t, report.Readings, 1)
+	require.Equal(t, "homekit_temperature", report.Readings[0].Measurement)
+	require.Len(t, report.Errors, 1)
+	require.Equal(t, "Name_Room_Light", report.Errors[0].Key)
+
+	rsp, err = http.Get(fmt.Sprintf("http://%s/status", address))
+	require.NoError(t, err)
+	defer rsp.Body.Close()
+	require.Equal(t, http.StatusOK, rsp.StatusCode)
+	require.Equal(t, "text/html; charset=utf-8", rsp.Header.Get("Content-Type"))
+	html, err := io.ReadAll(rsp.Body)
+	require.NoError(t, err)
+	require.Contains(t, string(html), "TestMonitor")
+	require.Contains(t, string(html), "unrecognized value type")
+	require.Contains(t, string(html), "<svg")
+
+	rsp, err = http.Get(fmt.Sprintf("http://%s/status/setup.png", address))
+	require.NoError(t, err)
+	defer rsp.Body.Close()
+	require.Equal(t, http.StatusOK, rsp.StatusCode)
+	require.Equal(t, "image/png", rsp.Header.Get("Content-Type"))
+
+	rsp, err = http.Get(fmt.Sprintf("http://%s/status/setup.svg", address))
+	require.NoError(t, err)
+	defer rsp.Body.Close()
+	require.Equal(t, http.StatusOK, rsp.StatusCode)
+	require.Equal(t, "image/svg+xml", rsp.Header.Get("Content-Type"))
+}
+
+func TestStatusPageDisabledByDefault(t *testing.T) {
+	address := freeAddress(t)
+
+	plugin := NewHomeKit()
+	plugin.Address = address
+	plugin.HAPStorePath = "../../../build/.hap"
+	plugin.MonitorAccessoryName = "TestMonitor"
+	plugin.Log = createDummyLogger()
+
+	acc := &testutil.Accumulator{}
+
+	defer plugin.Stop()
+	require.NoError(t, plugin.Start(acc))
+	waitForAddress(t, address)
+
+	for _, path := range []string{"/status", "/status/setup.png", "/status/setup.svg"} {
+		rsp, err := http.Get(fmt.Sprintf("http://%s%s", address, path))
+		require.NoError(t, err)
+		rsp.Body.Close()
+		require.Equal(t, http.StatusNotFound, rsp.StatusCode, path)
+	}
+}
+
+func TestStatusPageHidesSetupCode(t *testing.T) {
+	address := freeAddress(t)
+
+	plugin := NewHomeKit()
+	plugin.Address = address
+	plugin.HAPStorePath = "../../../build/.hap"
+	plugin.MonitorAccessoryName = "TestMonitor"
+	plugin.StatusPath = "/status"
+	plugin.Log = createDummyLogger()
+
+	acc := &testutil.Accumulator{}
+
+	defer plugin.Stop()
+	require.NoError(t, plugin.Start(acc))
+	waitForAddress(t, address)
+
+	rsp, err := http.Get(fmt.Sprintf("http://%s/status?format=json", address))
+	require.NoError(t, err)
+	defer rsp.Body.Close()
+	require.Equal(t, http.StatusOK, rsp.StatusCode)
+	report := &statusReport{}
+	require.NoError(t, json.NewDecoder(rsp.Body).Decode(report))
+	require.Equal(t, "TestMonitor", report.Monitor)
+	require.Empty(t, report.SetupURI)
+	require.Empty(t, report.SetupCode)
+
+	rsp, err = http.Get(fmt.Sprintf("http://%s/status", address))
+	require.NoError(t, err)
+	defer rsp.Body.Close()
+	require.Equal(t, http.StatusOK, rsp.StatusCode)
+	html, err := io.ReadAll(rsp.Body)
+	require.NoError(t, err)
+	require.NotContains(t, string(html), "001-02-003")
+	require.NotContains(t, string(html), "<svg")
+
+	for _, image := range []string{"setup.png", "setup.svg"} {
+		rsp, err = http.Get(fmt.Sprintf("http://%s/status/%s", address, image))
+		require.NoError(t, err)
+		defer rsp.Body.Close()
+		require.Equal(t, http.StatusForbidden, rsp.StatusCode)
+	}
+}
@@ -0,0 +1,266 @@
+// store.go
+//
+// Copyright (C) 2023-2024 Holger de Carne
+//
+// This software may be modified and distributed under the terms
+// of the MIT license.  See the LICENSE file for details.
+
+package homekit
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/brutella/hap"
+)
+
+const pairingKeySuffix = ".pairing"
+const uuidKey = "uuid"
+
+var storeKeys = []string{uuidKey, encryptionKey, "version", "schema", "keypair", "configHash", setupIDKey, pinKey, controllerKey}
+var storeKeySuffixes = []string{pairingKeySuffix, ".entity", accessoryPairingKeySuffix}
+
+// StoreInfo describes the state of the configured HAP store.
+type StoreInfo struct {
+	Path     string
+	DeviceID string
+	SetupID  string
+	Pin      string
+	SetupURI string
+	Pairings []hap.Pairing
+}
+
+// StoreInfo reads the state of the configured HAP store.
+func (plugin *HomeKit) StoreInfo() (*StoreInfo, error) {
+	store, err := plugin.openStore(false)
+	if err != nil {
+		return nil, err
+	}
+	defer CloseHAPStore(store)
+	info := &StoreInfo{Path: plugin.HAPStorePath}
+	deviceID, err := store.Get(uuidKey)
+	if err == nil {
+		info.DeviceID = string(deviceID)
+	}
+	setupID, err := store.Get(setupIDKey)
+	if err == nil {
+		info.SetupID = string(setupID)
+	}
+	if plugin.MonitorAccessoryPin != randomPin {
+		info.Pin, _ = normalizePin(plugin.MonitorAccessoryPin)
+	} else if pin, err := store.Get(pinKey); err == nil {
+		info.Pin = string(pin)
+	}
+	if info.SetupID != "" && info.Pin != "" {
+		info.SetupURI, _ = setupURI(plugin.accessoryCategory(), info.Pin, info.SetupID)
+	}
+	info.Pairings, err = storePairings(store)
+	if err != nil {
+		return nil, err
+	}
+	return info, nil
+}
+
+// Pairings lists the controller pairings of the configured HAP store.
+func (plugin *HomeKit) Pairings() ([]hap.Pairing, error) {
+	store, err := plugin.openStore(false)
+	if err != nil {
+		return nil, err
+	}
+	defer CloseHAPStore(store)
+	return storePairings(store)
+}
+
+// RemovePairing removes the controller pairing with the given name from the configured HAP store. The pairing
+// is only removed if the HAP server is not running, as a running plugin would otherwise restore it.
+func (plugin *HomeKit) RemovePairing(name string) error {
+	err := plugin.checkServerStopped("removing a pairing from")
+	if err != nil {
+		return err
+	}
+	store, err := plugin.openStore(false)
+	if err != nil {
+		return err
+	}
+	defer CloseHAPStore(store)
+	key := hex.EncodeToString([]byte(name)) + pairingKeySuffix
+	_, err = store.Get(key)
+	if err != nil {
+		return fmt.Errorf("unknown pairing '%s'", name)
+	}
+	return store.Delete(key)
+}
+
+// ResetStore deletes the configured HAP store. The store is only deleted if the HAP server is not running
+// and (unless forced) the store contains no unexpected files.
+func (plugin *HomeKit) ResetStore(force bool) error {
+	if !isStoreDirType(plugin.HAPStoreType) {
+		return plugin.resetStoreFile(force)
+	}
+	entries, err := os.ReadDir(plugin.HAPStorePath)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	err = plugin.checkServerStopped("resetting")
+	if err != nil {
+		return err
+	}
+	if !force {
+		for _, entry := range entries {
+			if !entry.Type().IsRegular() || !isStoreKey(entry.Name()) {
+				return fmt.Errorf("unexpected HAP store entry '%s'; refusing to reset HAP store %s", entry.Name(), plugin.HAPStorePath)
+			}
+		}
+	}
+	for _, entry := range entries {
+		err = os.RemoveAll(filepath.Join(plugin.HAPStorePath, entry.Name()))
+		if err != nil {
+			return err
+		}
+	}
+	return os.Remove(plugin.HAPStorePath)
+}
+
+func (plugin *HomeKit) resetStoreFile(force bool) error {
+	_, err := os.Stat(plugin.HAPStorePath)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	err = plugin.checkServerStopped("resetting")
+	if err != nil {
+		return err
+	}
+	if !force {
+		store, err := OpenHAPStore(plugin.HAPStoreType, plugin.HAPStorePath)
+		if err != nil {
+			return err
+		}
+		keys, err := store.KeysWithSuffix("")
+		CloseHAPStore(store)
+		if err != nil {
+			return err
+		}
+		for _, key := range keys {
+			if !isStoreKey(key) {
+				return fmt.Errorf("unexpected HAP store entry '%s'; refusing to reset HAP store %s", key, plugin.HAPStorePath)
+			}
+		}
+	}
+	return os.Remove(plugin.HAPStorePath)
+}
+
+func (plugin *HomeKit) checkServerStopped(action string) error {
+	listener, err := net.Listen("tcp", plugin.Address)
+	if err != nil {
+		return fmt.Errorf("HAP server address %s is in use; stop the plugin before %s the HAP store (cause: %v)", plugin.Address, action, err)
+	}
+	return listener.Close()
+}
+
+var errNoStoreEntry = errors.New("no HAP store entry")
+
+// isNoStoreEntry checks whether the given error indicates a missing HAP store entry.
+func isNoStoreEntry(err error) bool {
+	return errors.Is(err, errNoStoreEntry) || errors.Is(err, os.ErrNotExist)
+}
+
+func isStoreKey(key string) bool {
+	for _, storeKey := range storeKeys {
+		if key == storeKey {
+			return true
+		}
+	}
+	for _, storeKeySuffix := range storeKeySuffixes {
+		if strings.HasSuffix(key, storeKeySuffix) {
+			return true
+		}
+	}
+	return false
+}
+
+// openStore opens the configured HAP store. If create is set (i.e. on plugin start), a missing HAP store is
+// created and a not yet encrypted HAP store is encrypted (if encryption is enabled). Otherwise (e.g. when
+// accessed via the command line) a not yet encrypted HAP store is accessed as is and left untouched.
+func (plugin *HomeKit) openStore(create bool) (hap.Store, error) {
+	if !create {
+		info, err := os.Stat(plugin.HAPStorePath)
+		if err != nil {
+			return nil, fmt.Errorf("inaccessible HAP store %s (cause: %v)", plugin.HAPStorePath, err)
+		}
+		if isStoreDirType(plugin.HAPStoreType) && !info.IsDir() {
+			return nil, fmt.Errorf("invalid HAP store %s (not a directory)", plugin.HAPStorePath)
+		} else if !isStoreDirType(plugin.HAPStoreType) && info.IsDir() {
+			return nil, fmt.Errorf("invalid HAP store %s (not a file)", plugin.HAPStorePath)
+		}
+	}
+	store, err := OpenHAPStore(plugin.HAPStoreType, plugin.HAPStorePath)
+	if err != nil {
+		return nil, err
+	}
+	if create {
+		store, err = plugin.encryptStore(store)
+		if err != nil {
+			if store != nil {
+				CloseHAPStore(store)
+			}
+			return nil, err
+		}
+	} else if plugin.isStoreEncryptionEnabled() {
+		encryption, err := readStoreEncryption(store)
+		if err != nil {
+			CloseHAPStore(store)
+			return nil, err
+		}
+		if encryption == nil {
+			return store, nil
+		}
+	}
+	wrappedStore, err := plugin.wrapStore(store)
+	if err != nil {
+		CloseHAPStore(store)
+		return nil, err
+	}
+	return wrappedStore, nil
+}
+
+func (plugin *HomeKit) pairedControllers() int {
+	pairings, err := storePairings(plugin.store)
+	if err != nil {
+		plugin.Log.Warnf("Failed to read pairings (cause: %v)", err)
+		return 0
+	}
+	return len(pairings)
+}
+
+func storePairings(store hap.Store) ([]hap.Pairing, error) {
+	keys, err := store.KeysWithSuffix(pairingKeySuffix)
+	if err != nil {
+		return nil, err
+	}
+	pairings := make([]hap.Pairing, 0, len(keys))
+	for _, key := range keys {
+		pairingBytes, err := store.Get(key)
+		if err != nil {
+			return nil, err
+		}
+		var pairing hap.Pairing
+		err = json.Unmarshal(pairingBytes, &pairing)
+		if err != nil {
+			return nil, err
+		}
+		pairings = append(pairings, pairing)
+	}
+	sort.Slice(pairings, func(i, j int) bool { return pairings[i].Name < pairings[j].Name })
+	return pairings, nil
+}
@@ -0,0 +1,95 @@
+// store_test.go
+//
+// # Copyright (C) 2023-2024 Holger de Carne
+//
+// This software may be modified and distributed under the terms
+// of the MIT license.  See the LICENSE file for details.
+package homekit
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/brutella/hap"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStorePairings(t *testing.T) {
+	plugin := NewHomeKit()
+	plugin.Address = freeAddress(t)
+	plugin.HAPStorePath = filepath.Join(t.TempDir(), ".hap")
+	plugin.Log = createDummyLogger()
+
+	_, err := plugin.Pairings()
+	require.Error(t, err)
+
+	store, err := plugin.openStore(true)
+	require.NoError(t, err)
+	require.NoError(t, store.Set(uuidKey, []byte("00:11:22:33:44:55")))
+	savePairing(t, store, hap.Pairing{Name: "Controller1", Permission: hap.PermissionAdmin})
+	savePairing(t, store, hap.Pairing{Name: "Controller2", Permission: hap.PermissionUser})
+
+	info, err := plugin.StoreInfo()
+	require.NoError(t, err)
+	require.Equal(t, "00:11:22:33:44:55", info.DeviceID)
+	require.Equal(t, "00102003", info.Pin)
+	require.Len(t, info.Pairings, 2)
+
+	require.NoError(t, plugin.RemovePairing("Controller2"))
+	require.Error(t, plugin.RemovePairing("Controller3"))
+	pairings, err := plugin.Pairings()
+	require.NoError(t, err)
+	require.Len(t, pairings, 1)
+	require.Equal(t, "Controller1", pairings[0].Name)
+}
+
+func TestRemovePairingWhileRunning(t *testing.T) {
+	listener, err := net.Listen("tcp", "localhost:0")
+	require.NoError(t, err)
+	defer listener.Close()
+	plugin := NewHomeKit()
+	plugin.Address = listener.Addr().String()
+	plugin.HAPStoreType = "json"
+	plugin.HAPStorePath = filepath.Join(t.TempDir(), "hap.json")
+	plugin.Log = createDummyLogger()
+
+	store, err := plugin.openStore(true)
+	require.NoError(t, err)
+	savePairing(t, store, hap.Pairing{Name: "Controller1", Permission: hap.PermissionAdmin})
+	require.NoError(t, CloseHAPStore(store))
+
+	require.ErrorContains(t, plugin.RemovePairing("Controller1"), "stop the plugin")
+	pairings, err := plugin.Pairings()
+	require.NoError(t, err)
+	require.Len(t, pairings, 1)
+}
+
+func TestResetStore(t *testing.T) {
+	plugin := NewHomeKit()
+	plugin.Address = freeAddress(t)
+	plugin.HAPStorePath = filepath.Join(t.TempDir(), ".hap")
+	plugin.Log = createDummyLogger()
+
+	require.NoError(t, plugin.ResetStore(false))
+
+	store, err := plugin.openStore(true)
+	require.NoError(t, err)
+	require.NoError(t, store.Set(uuidKey, []byte("00:11:22:33:44:55")))
+	savePairing(t, store, hap.Pairing{Name: "Controller1", Permission: hap.PermissionAdmin})
+	require.NoError(t, os.WriteFile(filepath.Join(plugin.HAPStorePath, "unexpected.txt"), []byte{}, 0640))
+
+	require.Error(t, plugin.ResetStore(false))
+	require.DirExists(t, plugin.HAPStorePath)
+	require.NoError(t, plugin.ResetStore(true))
+	require.NoDirExists(t, plugin.HAPStorePath)
+}
+
+func savePairing(t *testing.T, store hap.Store, pairing hap.Pairing) {
+	pairingBytes, err := json.Marshal(&pairing)
+	require.NoError(t, err)
+	require.NoError(t, store.Set(hex.EncodeToString([]byte(pairing.Name))+pairingKeySuffix, pairingBytes))
+}
@@ -0,0 +1,293 @@
+// storetype.go
+//
+// Copyright (C) 2023-2024 Holger de Carne
+//
+// This software may be modified and distributed under the terms
+// of the MIT license.  See the LICENSE file for details.
+
+package homekit
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/brutella/hap"
+	bolt "go.etcd.io/bbolt"
+	_ "modernc.org/sqlite"
+)
+
+const (
+	storeTypeFs     = "fs"
+	storeTypeJSON   = "json"
+	storeTypeBbolt  = "bbolt"
+	storeTypeSQLite = "sqlite"
+)
+
+// The functions opening (and creating if necessary) the HAP store of a given type
+var storeTypes = map[string]func(path string) (hap.Store, error){
+	storeTypeFs:     openFsStore,
+	storeTypeJSON:   openJSONStore,
+	storeTypeBbolt:  openBboltStore,
+	storeTypeSQLite: openSQLiteStore,
+}
+
+// IsStoreType checks whether the given HAP store type is supported by OpenHAPStore.
+func IsStoreType(storeType string) bool {
+	return storeTypes[storeType] != nil
+}
+
+// isStoreDirType checks whether the given HAP store type uses a directory (fs) or a single file.
+func isStoreDirType(storeType string) bool {
+	return storeType == "" || storeType == storeTypeFs
+}
+
+// OpenHAPStore opens the HAP store of the given type (fs, json, bbolt or sqlite) at the given path. The fs
+// store keeps every entry in a separate file within the given directory, all other types keep all entries
+// in the given file. The store directory or file is created if it does not yet exist.
+func OpenHAPStore(storeType string, path string) (hap.Store, error) {
+	if storeType == "" {
+		storeType = storeTypeFs
+	}
+	open := storeTypes[storeType]
+	if open == nil {
+		return nil, fmt.Errorf("unknown HAP store type '%s'", storeType)
+	}
+	return open(path)
+}
+
+// CloseHAPStore releases the resources (e.g. file locks) held by a HAP store opened via OpenHAPStore.
+func CloseHAPStore(store hap.Store) error {
+	closer, ok := store.(io.Closer)
+	if !ok {
+		return nil
+	}
+	return closer.Close()
+}
+
+func openFsStore(path string) (hap.Store, error) {
+	err := os.MkdirAll(path, 0750)
+	if err != nil {
+		return nil, err
+	}
+	return hap.NewFsStore(path), nil
+}
+
+// jsonStore keeps all entries in a single JSON file, which is rewritten on every change.
+type jsonStore struct {
+	path    string
+	entries map[string][]byte
+	mutex   sync.Mutex
+}
+
+func openJSONStore(path string) (hap.Store, error) {
+	store := &jsonStore{path: path, entries: make(map[string][]byte)}
+	storeBytes, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return store, store.write()
+	} else if err != nil {
+		return nil, err
+	}
+	err = json.Unmarshal(storeBytes, &store.entries)
+	if err != nil {
+		return nil, fmt.Errorf("invalid HAP store %s (cause: %v)", path, err)
+	}
+	return store, nil
+}
+
+// write replaces the store file atomically (the caller must hold the lock if the store is in use).
+func (store *jsonStore) write() error {
+	storeBytes, err := json.MarshalIndent(store.entries, "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(store.path, storeBytes)
+}
+
+func (store *jsonStore) Set(key string, value []byte) error {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+	store.entries[key] = value
+	return store.write()
+}
+
+func (store *jsonStore) Get(key string) ([]byte, error) {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+	value, ok := store.entries[key]
+	if !ok {
+		return nil, fmt.Errorf("%w '%s'", errNoStoreEntry, key)
+	}
+	return value, nil
+}
+
+func (store *jsonStore) Delete(key string) error {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+	if _, ok := store.entries[key]; !ok {
+		return fmt.Errorf("%w '%s'", errNoStoreEntry, key)
+	}
+	delete(store.entries, key)
+	return store.write()
+}
+
+func (store *jsonStore) KeysWithSuffix(suffix string) ([]string, error) {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+	keys := make([]string, 0)
+	for key := range store.entries {
+		if strings.HasSuffix(key, suffix) {
+			keys = append(keys, key)
+		}
+	}
+	return keys, nil
+}
+
+var bboltBucket = []byte("hap")
+
+// bboltStore keeps all entries in a single bbolt database file. The file is locked as long as the store is open.
+type bboltStore struct {
+	db *bolt.DB
+}
+
+func openBboltStore(path string) (hap.Store, error) {
+	db, err := bolt.Open(path, 0640, &bolt.Options{Timeout: time.Second})
+	if errors.Is(err, bolt.ErrTimeout) {
+		return nil, fmt.Errorf("HAP store %s is locked by another process (e.g. the running plugin)", path)
+	} else if err != nil {
+		return nil, fmt.Errorf("failed to open HAP store %s (cause: %v)", path, err)
+	}
+	err = db.Update(func(tx *bolt.Tx) error {
+		_, err := tx.CreateBucketIfNotExists(bboltBucket)
+		return err
+	})
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	return &bboltStore{db: db}, nil
+}
+
+func (store *bboltStore) Set(key string, value []byte) error {
+	return store.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(bboltBucket).Put([]byte(key), value)
+	})
+}
+
+func (store *bboltStore) Get(key string) ([]byte, error) {
+	var value []byte
+	err := store.db.View(func(tx *bolt.Tx) error {
+		storedValue := tx.Bucket(bboltBucket).Get([]byte(key))
+		if storedValue == nil {
+			return fmt.Errorf("%w '%s'", errNoStoreEntry, key)
+		}
+		// the stored value is only valid during the transaction
+		value = append([]byte(nil), storedValue...)
+		return nil
+	})
+	return value, err
+}
+
+func (store *bboltStore) Delete(key string) error {
+	return store.db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(bboltBucket)
+		if bucket.Get([]byte(key)) == nil {
+			return fmt.Errorf("%w '%s'", errNoStoreEntry, key)
+		}
+		return bucket.Delete([]byte(key))
+	})
+}
+
+func (store *bboltStore) KeysWithSuffix(suffix string) ([]string, error) {
+	keys := make([]string, 0)
+	err := store.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(bboltBucket).ForEach(func(key []byte, _ []byte) error {
+			if strings.HasSuffix(string(key), suffix) {
+				keys = append(keys, string(key))
+			}
+			return nil
+		})
+	})
+	return keys, err
+}
+
+func (store *bboltStore) Close() error {
+	return store.db.Close()
+}
+
+// sqliteStore keeps all entries in a single SQLite database file.
+type sqliteStore struct {
+	db *sql.DB
+}
+
+func openSQLiteStore(path string) (hap.Store, error) {
+	db, err := sql.Open("sqlite", path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open HAP store %s (cause: %v)", path, err)
+	}
+	_, err = db.Exec("CREATE TABLE IF NOT EXISTS hap_store (key TEXT PRIMARY KEY, value BLOB NOT NULL)")
+	if err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to open HAP store %s (cause: %v)", path, err)
+	}
+	return &sqliteStore{db: db}, nil
+}
+
+func (store *sqliteStore) Set(key string, value []byte) error {
+	_, err := store.db.Exec("INSERT INTO hap_store (key, value) VALUES (?, ?) ON CONFLICT (key) DO UPDATE SET value = excluded.value", key, value)
+	return err
+}
+
+func (store *sqliteStore) Get(key string) ([]byte, error) {
+	var value []byte
+	err := store.db.QueryRow("SELECT value FROM hap_store WHERE key = ?", key).Scan(&value)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, fmt.Errorf("%w '%s'", errNoStoreEntry, key)
+	}
+	return value, err
+}
+
+func (store *sqliteStore) Delete(key string) error {
+	result, err := store.db.Exec("DELETE FROM hap_store WHERE key = ?", key)
+	if err != nil {
+		return err
+	}
+	deleted, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if deleted == 0 {
+		return fmt.Errorf("%w '%s'", errNoStoreEntry, key)
+	}
+	return nil
+}
+
+func (store *sqliteStore) KeysWithSuffix(suffix string) ([]string, error) {
+	rows, err := store.db.Query("SELECT key FROM hap_store")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	keys := make([]string, 0)
+	for rows.Next() {
+		var key string
+		err = rows.Scan(&key)
+		if err != nil {
+			return nil, err
+		}
+		if strings.HasSuffix(key, suffix) {
+			keys = append(keys, key)
+		}
+	}
+	return keys, rows.Err()
+}
+
+func (store *sqliteStore) Close() error {
+	return store.db.Close()
+}
@@ -0,0 +1,91 @@
+// storetype_test.go
+//
+// # Copyright (C) 2023-2024 Holger de Carne
+//
+// This software may be modified and distributed under the terms
+// of the MIT license.  See the LICENSE file for details.
+package homekit
+
+import (
+	"bytes"
+	"path/filepath"
+	"sort"
+	"testing"
+
+	"github.com/brutella/hap"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStoreTypes(t *testing.T) {
+	for storeType := range storeTypes {
+		t.Run(storeType, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "hap-store")
+			store, err := OpenHAPStore(storeType, path)
+			require.NoError(t, err)
+			keys, err := store.KeysWithSuffix("")
+			require.NoError(t, err)
+			require.Empty(t, keys)
+			_, err = store.Get(uuidKey)
+			require.Error(t, err)
+			require.NoError(t, store.Set(uuidKey, []byte("00:11:22:33:44:55")))
+			require.NoError(t, store.Set("keypair", []byte{0, 1, 2}))
+			require.NoError(t, store.Set("keypair", []byte{3, 4, 5}))
+			savePairing(t, store, hap.Pairing{Name: "Controller1", Permission: hap.PermissionAdmin})
+			require.NoError(t, CloseHAPStore(store))
+
+			store, err = OpenHAPStore(storeType, path)
+			require.NoError(t, err)
+			defer CloseHAPStore(store)
+			value, err := store.Get("keypair")
+			require.NoError(t, err)
+			require.Equal(t, []byte{3, 4, 5}, value)
+			keys, err = store.KeysWithSuffix("")
+			require.NoError(t, err)
+			sort.Strings(keys)
+			require.Equal(t, []string{"436f6e74726f6c6c657231.pairing", "keypair", uuidKey}, keys)
+			pairings, err := storePairings(store)
+			require.NoError(t, err)
+			require.Len(t, pairings, 1)
+			require.NoError(t, store.Delete("keypair"))
+			require.Error(t, store.Delete("keypair"))
+			keys, err = store.KeysWithSuffix(pairingKeySuffix)
+			require.NoError(t, err)
+			require.Len(t, keys, 1)
+		})
+	}
+	_, err := OpenHAPStore("unknown", filepath.Join(t.TempDir(), "hap-store"))
+	require.Error(t, err)
+}
+
+func TestFileStoreMigration(t *testing.T) {
+	source := NewHomeKit()
+	source.Address = freeAddress(t)
+	source.HAPStorePath = filepath.Join(t.TempDir(), ".hap")
+	source.Log = createDummyLogger()
+	store, err := source.openStore(true)
+	require.NoError(t, err)
+	require.NoError(t, store.Set(uuidKey, []byte("00:11:22:33:44:55")))
+	savePairing(t, store, hap.Pairing{Name: "Controller1", Permission: hap.PermissionAdmin})
+	var archive bytes.Buffer
+	_, err = source.ExportStore(&archive, "")
+	require.NoError(t, err)
+
+	target := NewHomeKit()
+	target.Address = freeAddress(t)
+	target.HAPStoreType = "sqlite"
+	target.HAPStorePath = filepath.Join(t.TempDir(), "hap.db")
+	target.Log = createDummyLogger()
+	_, err = target.StoreInfo()
+	require.Error(t, err)
+	imported, err := target.ImportStore(bytes.NewReader(archive.Bytes()), "", false)
+	require.NoError(t, err)
+	require.Equal(t, 2, imported)
+	info, err := target.StoreInfo()
+	require.NoError(t, err)
+	require.Equal(t, "00:11:22:33:44:55", info.DeviceID)
+	require.Len(t, info.Pairings, 1)
+
+	require.NoError(t, target.ResetStore(false))
+	_, err = target.StoreInfo()
+	require.Error(t, err)
+}
@@ -0,0 +1,251 @@
+// trigger.go
+//
+// Copyright (C) 2023-2024 Holger de Carne
+//
+// This software may be modified and distributed under the terms
+// of the MIT license.  See the LICENSE file for details.
+
+package homekit
+
+import (
+	"context"
+	"fmt"
+	"sync/atomic"
+	"time"
+
+	"github.com/brutella/hap/accessory"
+	"github.com/brutella/hap/characteristic"
+	"github.com/brutella/hap/service"
+	"github.com/influxdata/telegraf/config"
+)
+
+const (
+	triggerTypeSwitch             = "switch"
+	triggerTypeProgrammableSwitch = "programmable_switch"
+	triggerTypeMotionSensor       = "motion_sensor"
+	triggerTypeOccupancySensor    = "occupancy_sensor"
+)
+
+var triggerCategories = map[string]byte{
+	triggerTypeSwitch:             accessory.TypeSwitch,
+	triggerTypeProgrammableSwitch: accessory.TypeProgrammableSwitch,
+	triggerTypeMotionSensor:       accessory.TypeSensor,
+	triggerTypeOccupancySensor:    accessory.TypeSensor,
+}
+
+// TriggerConfig defines an additional trigger accessory and its schedule.
+type TriggerConfig struct {
+	Name     string          `toml:"name"`
+	Type     string          `toml:"type"`
+	Interval config.Duration `toml:"interval"`
+}
+
+type trigger struct {
+	name      string
+	interval  time.Duration
+	accessory *accessory.A
+	activate  func(active bool)
+	firing    atomic.Bool
+}
+
+func newTrigger(name string, triggerType string, interval time.Duration) (*trigger, error) {
+	category, ok := triggerCategories[triggerType]
+	if !ok {
+		return nil, fmt.Errorf("unknown trigger type '%s'", triggerType)
+	}
+	a := accessory.New(AccessoryInfo(name), category)
+	var activate func(active bool)
+	switch triggerType {
+	case triggerTypeSwitch:
+		s := service.NewSwitch()
+		a.AddS(s.S)
+		activate = func(active bool) {
+			s.On.SetValue(active)
+		}
+	case triggerTypeProgrammableSwitch:
+		s := service.NewStatelessProgrammableSwitch()
+		a.AddS(s.S)
+		activate = func(active bool) {
+			if active {
+				s.ProgrammableSwitchEvent.SetValue(characteristic.ProgrammableSwitchEventSinglePress)
+			}
+		}
+	case triggerTypeMotionSensor:
+		s := service.NewMotionSensor()
+		a.AddS(s.S)
+		activate = func(active bool) {
+			s.MotionDetected.SetValue(active)
+		}
+	case triggerTypeOccupancySensor:
+		s := service.NewOccupancySensor()
+		a.AddS(s.S)
+		activate = func(active bool) {
+			if active {
+				s.OccupancyDetected.SetValue(characteristic.OccupancyDetectedOccupancyDetected)
+			} else {
+				s.OccupancyDetected.SetValue(characteristic.OccupancyDetectedOccupancyNotDetected)
+			}
+		}
+	}
+	return &trigger{
+		name:      name,
+		interval:  interval,
+		accessory: a,
+		activate:  activate,
+	}, nil
+}
+
+// setupAccessories creates the trigger accessories and returns the accessories to publish via the HAP server.
+// Without any configured triggers, the monitor accessory itself acts as the single trigger fired on every
+// Gather. Otherwise (or if explicitly requested) the monitor accessory is a bridge for the triggers and the
+// derived sensors.
+func (plugin *HomeKit) setupAccessories() (*accessory.A, []*accessory.A, error) {
+	triggerConfigs := plugin.Triggers
+	if len(triggerConfigs) == 0 {
+		if !plugin.MonitorBridge && len(plugin.Sensors) == 0 {
+			plugin.Log.Infof("Setting up monitor accessory: %s (type: %s)", plugin.MonitorAccessoryName, plugin.TriggerType)
+			monitorTrigger, err := newTrigger(plugin.MonitorAccessoryName, plugin.TriggerType, 0)
+			if err != nil {
+				return nil, nil, err
+			}
+			plugin.triggers = []*trigger{monitorTrigger}
+			return monitorTrigger.accessory, nil, nil
+		}
+		triggerConfigs = []TriggerConfig{{Name: plugin.MonitorAccessoryName + " Trigger"}}
+	}
+	plugin.Log.Infof("Setting up monitor bridge: %s", plugin.MonitorAccessoryName)
+	bridge := accessory.NewBridge(AccessoryInfo(plugin.MonitorAccessoryName))
+	plugin.triggers = make([]*trigger, 0, len(triggerConfigs))
+	bridgedAccessories := make([]*accessory.A, 0, len(triggerConfigs))
+	for _, triggerConfig := range triggerConfigs {
+		triggerType := plugin.triggerType(triggerConfig)
+		plugin.Log.Infof("Setting up trigger accessory: %s (type: %s, interval: %s)", triggerConfig.Name, triggerType, time.Duration(triggerConfig.Interval))
+		bridgedTrigger, err := newTrigger(triggerConfig.Name, triggerType, time.Duration(triggerConfig.Interval))
+		if err != nil {
+			return nil, nil, err
+		}
+		plugin.triggers = append(plugin.triggers, bridgedTrigger)
+		bridgedAccessories = append(bridgedAccessories, bridgedTrigger.accessory)
+	}
+	sensorAccessories, err := plugin.setupSensors()
+	if err != nil {
+		return nil, nil, err
+	}
+	return bridge.A, append(bridgedAccessories, sensorAccessories...), nil
+}
+
+func (plugin *HomeKit) triggerType(triggerConfig TriggerConfig) string {
+	if triggerConfig.Type != "" {
+		return triggerConfig.Type
+	}
+	return plugin.TriggerType
+}
+
+func (plugin *HomeKit) accessoryCategory() byte {
+	if len(plugin.Triggers) > 0 || len(plugin.Sensors) > 0 || plugin.MonitorBridge {
+		return accessory.TypeBridge
+	}
+	return triggerCategories[plugin.TriggerType]
+}
+
+func (plugin *HomeKit) scheduleTriggers(ctx context.Context) {
+	for _, scheduledTrigger := range plugin.triggers {
+		if scheduledTrigger.interval <= 0 {
+			continue
+		}
+		plugin.serverStopped.Add(1)
+		go func(scheduledTrigger *trigger) {
+			defer plugin.serverStopped.Done()
+			ticker := time.NewTicker(scheduledTrigger.interval)
+			defer ticker.Stop()
+			for {
+				select {
+				case <-ctx.Done():
+					return
+				case <-ticker.C:
+					plugin.fireTrigger(scheduledTrigger)
+				}
+			}
+		}(scheduledTrigger)
+	}
+}
+
+// fireTrigger asynchronously pulses the given trigger accessory. If a trigger timeout is configured, the trigger is
+// retried (with doubled timeout) until a monitor request is received or the retries are exhausted.
+func (plugin *HomeKit) fireTrigger(trigger *trigger) {
+	if !plugin.checkPaired(trigger) {
+		return
+	}
+	if !trigger.firing.CompareAndSwap(false, true) {
+		plugin.Log.Warnf("Skipping trigger of monitor accessory %s (still running)", trigger.name)
+		return
+	}
+	plugin.serverStopped.Add(1)
+	go func() {
+		defer plugin.serverStopped.Done()
+		defer trigger.firing.Store(false)
+		plugin.runTrigger(plugin.serverCtx, trigger)
+	}()
+}
+
+func (plugin *HomeKit) runTrigger(ctx context.Context, trigger *trigger) {
+	timeout := time.Duration(plugin.TriggerTimeout)
+	for retry := 0; ; retry++ {
+		if plugin.Debug {
+			plugin.Log.Infof("Triggering monitor accessory: %s", trigger.name)
+		}
+		pushed := plugin.status.pushNotify()
+		plugin.status.recordTrigger(time.Now())
+		plugin.triggerCount.Add(1)
+		if !plugin.pulseTrigger(ctx, trigger) || timeout <= 0 {
+			return
+		}
+		timer := time.NewTimer(timeout)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-pushed:
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+		if retry >= plugin.TriggerRetries {
+			plugin.Log.Warnf("No monitor request received after triggering monitor accessory %s (giving up after %d retries)", trigger.name, retry)
+			plugin.triggerFailures.Add(1)
+			return
+		}
+		plugin.Log.Warnf("No monitor request received within %s after triggering monitor accessory %s (retrying)", timeout, trigger.name)
+		plugin.triggerRetries.Add(1)
+		timeout *= 2
+	}
+}
+
+func (plugin *HomeKit) pulseTrigger(ctx context.Context, trigger *trigger) bool {
+	trigger.activate(true)
+	defer trigger.activate(false)
+	timer := time.NewTimer(time.Duration(plugin.TriggerPulse))
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return false
+	case <-timer.C:
+		return true
+	}
+}
+
+// checkPaired checks whether any controller is paired with the monitor accessory, as triggering an unpaired
+// accessory is pointless. The setup code is logged once as soon as triggering is skipped due to missing pairings.
+func (plugin *HomeKit) checkPaired(trigger *trigger) bool {
+	if plugin.pairedControllers() > 0 {
+		plugin.unpairedWarned.Store(false)
+		return true
+	}
+	if !plugin.unpairedWarned.Swap(true) {
+		plugin.Log.Warnf("No controller paired with monitor accessory '%s'; pair it via the Home app to enable triggering", plugin.MonitorAccessoryName)
+		plugin.logSetupCode()
+	} else if plugin.Debug {
+		plugin.Log.Infof("Skipping trigger of monitor accessory %s (no controller paired)", trigger.name)
+	}
+	return false
+}
@@ -0,0 +1,151 @@
+// trigger_test.go
+//
+// # Copyright (C) 2023-2024 Holger de Carne
+//
+// This software may be modified and distributed under the terms
+// of the MIT license.  See the LICENSE file for details.
+package homekit
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/brutella/hap"
+	"github.com/brutella/hap/accessory"
+	"github.com/influxdata/telegraf/config"
+	"github.com/influxdata/telegraf/testutil"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRunTriggers(t *testing.T) {
+	plugin := NewHomeKit()
+	plugin.Address = freeAddress(t)
+	plugin.HAPStorePath = filepath.Join(t.TempDir(), ".hap")
+	plugin.MonitorAccessoryName = "TestMonitor"
+	plugin.Triggers = []TriggerConfig{
+		{Name: "TestMonitor Fast", Interval: config.Duration(50 * time.Millisecond)},
+		{Name: "TestMonitor Poll"},
+	}
+	plugin.Log = createDummyLogger()
+	require.NoError(t, plugin.Init())
+
+	acc := &testutil.Accumulator{}
+
+	defer plugin.Stop()
+	require.NoError(t, plugin.Start(acc))
+	savePairing(t, plugin.store, hap.Pairing{Name: "Controller", Permission: hap.PermissionAdmin})
+	require.Equal(t, accessory.TypeBridge, plugin.accessoryCategory())
+	require.Len(t, plugin.triggers, 2)
+
+	require.Eventually(t, func() bool {
+		return plugin.statusReport().LastTrigger != nil
+	}, time.Second, 10*time.Millisecond)
+}
+
+func TestTriggerRetries(t *testing.T) {
+	address := freeAddress(t)
+
+	plugin := NewHomeKit()
+	plugin.Address = address
+	plugin.HAPStorePath = filepath.Join(t.TempDir(), ".hap")
+	plugin.MonitorAccessoryName = "TestMonitor"
+	plugin.TriggerPulse = config.Duration(10 * time.Millisecond)
+	plugin.TriggerTimeout = config.Duration(20 * time.Millisecond)
+	plugin.TriggerRetries = 2
+	plugin.Log = createDummyLogger()
+	require.NoError(t, plugin.Init())
+
+	acc := &testutil.Accumulator{}
+
+	defer plugin.Stop()
+	require.NoError(t, plugin.Start(acc))
+	savePairing(t, plugin.store, hap.Pairing{Name: "Controller", Permission: hap.PermissionAdmin})
+	require.NoError(t, plugin.Gather(acc))
+	require.Eventually(t, func() bool {
+		return plugin.triggerFailures.Load() == 1
+	}, 2*time.Second, 10*time.Millisecond)
+	require.Equal(t, int64(2), plugin.triggerRetries.Load())
+
+	plugin.TriggerTimeout = config.Duration(time.Second)
+	require.NoError(t, plugin.Gather(acc))
+	waitForAddress(t, address)
+	putJson(t, address, `{
+		"Name": "Yes"
+	}`)
+	require.Eventually(t, func() bool {
+		return !plugin.triggers[0].firing.Load()
+	}, time.Second, 10*time.Millisecond)
+	require.Equal(t, int64(2), plugin.triggerRetries.Load())
+	require.Equal(t, int64(1), plugin.triggerFailures.Load())
+}
+
+func TestSkipUnpairedTrigger(t *testing.T) {
+	plugin := NewHomeKit()
+	plugin.Address = freeAddress(t)
+	plugin.HAPStorePath = filepath.Join(t.TempDir(), ".hap")
+	plugin.MonitorAccessoryName = "TestMonitor"
+	plugin.Log = createDummyLogger()
+	require.NoError(t, plugin.Init())
+
+	acc := &testutil.Accumulator{}
+
+	defer plugin.Stop()
+	require.NoError(t, plugin.Start(acc))
+	require.NoError(t, plugin.Gather(acc))
+	require.Nil(t, plugin.statusReport().LastTrigger)
+	require.True(t, plugin.unpairedWarned.Load())
+	assertPluginStats(t, acc, map[string]interface{}{
+		"rejected_body_size":   int64(0),
+		"rejected_rate_limit":  int64(0),
+		"rejected_concurrency": int64(0),
+		"trigger_retries":      int64(0),
+		"trigger_failures":     int64(0),
+		"paired":               false,
+		"controllers":          0})
+
+	acc.ClearMetrics()
+	savePairing(t, plugin.store, hap.Pairing{Name: "Controller", Permission: hap.PermissionAdmin})
+	require.NoError(t, plugin.Gather(acc))
+	require.Eventually(t, func() bool {
+		return plugin.statusReport().LastTrigger != nil
+	}, time.Second, 10*time.Millisecond)
+	require.False(t, plugin.unpairedWarned.Load())
+	assertPluginStats(t, acc, map[string]interface{}{
+		"rejected_body_size":   int64(0),
+		"rejected_rate_limit":  int64(0),
+		"rejected_concurrency": int64(0),
+		"trigger_retries":      int64(0),
+		"trigger_failures":     int64(0),
+		"paired":               true,
+		"controllers":          1})
+}
+
+func TestTriggerTypes(t *testing.T) {
+	for triggerType, category := range triggerCategories {
+		trigger, err := newTrigger("Trigger", triggerType, 0)
+		require.NoError(t, err, triggerType)
+		require.Equal(t, category, trigger.accessory.Type, triggerType)
+		require.Len(t, trigger.accessory.Ss, 2, triggerType)
+		trigger.activate(true)
+		trigger.activate(false)
+	}
+	_, err := newTrigger("Trigger", "button", 0)
+	require.Error(t, err)
+}
+
+func TestMonitorBridge(t *testing.T) {
+	plugin := NewHomeKit()
+	plugin.MonitorAccessoryName = "TestMonitor"
+	plugin.MonitorBridge = true
+	plugin.TriggerType = triggerTypeProgrammableSwitch
+	plugin.Log = createDummyLogger()
+	require.NoError(t, plugin.Init())
+
+	monitorAccessory, bridgedAccessories, err := plugin.setupAccessories()
+	require.NoError(t, err)
+	require.Equal(t, accessory.TypeBridge, monitorAccessory.Type)
+	require.Equal(t, accessory.TypeBridge, plugin.accessoryCategory())
+	require.Len(t, bridgedAccessories, 1)
+	require.Equal(t, accessory.TypeProgrammableSwitch, bridgedAccessories[0].Type)
+}
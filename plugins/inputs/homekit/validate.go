@@ -0,0 +1,315 @@
+// validate.go
+//
+// Copyright (C) 2023-2024 Holger de Carne
+//
+// This software may be modified and distributed under the terms
+// of the MIT license.  See the LICENSE file for details.
+
+package homekit
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+type suffixSetting struct {
+	key      string
+	suffixes []string
+}
+
+func (plugin *HomeKit) Init() error {
+	if plugin.CelsiusSuffixesDeprecated != nil {
+		plugin.Log.Warnf("Option 'celsius_suffixex' is deprecated; use 'celsius_suffixes' instead")
+		plugin.CelsiusSuffixes = plugin.CelsiusSuffixesDeprecated
+	}
+	err := errors.Join(
+		validateAddress("address", plugin.Address, false),
+		validateAddress("monitor_address", plugin.MonitorAddress, true),
+		plugin.validatePaths(),
+		plugin.validateLimits(),
+		plugin.validateAccessory(),
+		plugin.validateTriggers(),
+		plugin.validateSensors(),
+		plugin.validateAccessories(),
+		plugin.validateValues(),
+	)
+	if err != nil {
+		return fmt.Errorf("invalid configuration:\n%w", err)
+	}
+	return nil
+}
+
+func validateAddress(key string, address string, optional bool) error {
+	if address == "" {
+		if optional {
+			return nil
+		}
+		return fmt.Errorf("%s: address must not be empty", key)
+	}
+	_, port, err := net.SplitHostPort(address)
+	if err != nil {
+		return fmt.Errorf("%s: invalid address '%s' (cause: %v)", key, address, err)
+	}
+	portNumber, err := strconv.ParseUint(port, 10, 16)
+	if err != nil {
+		return fmt.Errorf("%s: invalid port '%s' in address '%s'", key, port, address)
+	}
+	if portNumber == 0 {
+		return fmt.Errorf("%s: port must not be 0 in address '%s'", key, address)
+	}
+	return nil
+}
+
+func (plugin *HomeKit) validatePaths() error {
+	var errs []error
+	if !strings.HasPrefix(plugin.MonitorPath, "/") {
+		errs = append(errs, fmt.Errorf("monitor_path: path '%s' must start with '/'", plugin.MonitorPath))
+	}
+	if plugin.StatusPath != "" {
+		if !strings.HasPrefix(plugin.StatusPath, "/") {
+			errs = append(errs, fmt.Errorf("status_path: path '%s' must start with '/'", plugin.StatusPath))
+		} else if plugin.StatusPath == plugin.MonitorPath {
+			errs = append(errs, fmt.Errorf("status_path: path '%s' must differ from monitor_path", plugin.StatusPath))
+		}
+	}
+	if plugin.MetricsPath != "" {
+		if !strings.HasPrefix(plugin.MetricsPath, "/") {
+			errs = append(errs, fmt.Errorf("metrics_path: path '%s' must start with '/'", plugin.MetricsPath))
+		} else if plugin.MetricsPath == plugin.MonitorPath || plugin.MetricsPath == plugin.StatusPath {
+			errs = append(errs, fmt.Errorf("metrics_path: path '%s' must differ from monitor_path and status_path", plugin.MetricsPath))
+		}
+	}
+	if plugin.MetricsExpiry < 0 {
+		errs = append(errs, fmt.Errorf("metrics_expiry: expiry must not be negative"))
+	}
+	if !IsStoreType(plugin.HAPStoreType) {
+		errs = append(errs, fmt.Errorf("hap_store_type: unknown store type '%s'", plugin.HAPStoreType))
+	}
+	if plugin.HAPStorePath == "" {
+		errs = append(errs, fmt.Errorf("hap_store_path: path must not be empty"))
+	} else if info, err := os.Stat(plugin.HAPStorePath); err == nil && isStoreDirType(plugin.HAPStoreType) && !info.IsDir() {
+		errs = append(errs, fmt.Errorf("hap_store_path: '%s' is not a directory", plugin.HAPStorePath))
+	} else if err == nil && !isStoreDirType(plugin.HAPStoreType) && info.IsDir() {
+		errs = append(errs, fmt.Errorf("hap_store_path: '%s' is not a file", plugin.HAPStorePath))
+	}
+	switch plugin.HAPStoreEncryption {
+	case storeEncryptionEnv:
+		if plugin.HAPStoreKeyEnv == "" {
+			errs = append(errs, fmt.Errorf("hap_store_key_env: environment variable must not be empty"))
+		}
+	case storeEncryptionFile:
+		if plugin.HAPStoreKeyFile == "" {
+			errs = append(errs, fmt.Errorf("hap_store_key_file: path must not be empty"))
+		}
+	case storeEncryptionSecret:
+		if plugin.HAPStoreKey.Empty() {
+			errs = append(errs, fmt.Errorf("hap_store_key: key must not be empty"))
+		}
+	default:
+		if !storeEncryptions[plugin.HAPStoreEncryption] {
+			errs = append(errs, fmt.Errorf("hap_store_encryption: unknown encryption '%s'", plugin.HAPStoreEncryption))
+		}
+	}
+	if plugin.RecordPath != "" {
+		info, err := os.Stat(filepath.Dir(plugin.RecordPath))
+		if err != nil || !info.IsDir() {
+			errs = append(errs, fmt.Errorf("record_path: directory of '%s' does not exist", plugin.RecordPath))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func (plugin *HomeKit) validateLimits() error {
+	var errs []error
+	if plugin.MonitorReadTimeout < 0 || plugin.MonitorWriteTimeout < 0 {
+		errs = append(errs, fmt.Errorf("monitor_read_timeout/monitor_write_timeout: timeouts must not be negative"))
+	}
+	if plugin.MonitorMaxBodySize < 0 {
+		errs = append(errs, fmt.Errorf("monitor_max_body_size: size must not be negative"))
+	}
+	if plugin.MonitorRateLimit < 0 || plugin.MonitorRateBurst < 0 {
+		errs = append(errs, fmt.Errorf("monitor_rate_limit/monitor_rate_burst: limits must not be negative"))
+	}
+	if plugin.MonitorMaxConcurrent < 0 {
+		errs = append(errs, fmt.Errorf("monitor_max_concurrent: limit must not be negative"))
+	}
+	if plugin.RecordMaxSize < 0 || plugin.RecordMaxFiles < 1 {
+		errs = append(errs, fmt.Errorf("record_max_size/record_max_files: size must not be negative and at least one file must be kept"))
+	}
+	return errors.Join(errs...)
+}
+
+func (plugin *HomeKit) validateAccessory() error {
+	var errs []error
+	if strings.TrimSpace(plugin.MonitorAccessoryName) == "" {
+		errs = append(errs, fmt.Errorf("monitor_accessory_name: name must not be empty"))
+	}
+	if plugin.MonitorAccessoryPin != randomPin {
+		_, err := normalizePin(plugin.MonitorAccessoryPin)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("monitor_accessory_pin: %v", err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func (plugin *HomeKit) validateTriggers() error {
+	var errs []error
+	if _, ok := triggerCategories[plugin.TriggerType]; !ok {
+		errs = append(errs, fmt.Errorf("trigger_type: unknown trigger type '%s'", plugin.TriggerType))
+	}
+	if plugin.TriggerPulse <= 0 {
+		errs = append(errs, fmt.Errorf("trigger_pulse: pulse must be positive"))
+	}
+	if plugin.TriggerTimeout < 0 {
+		errs = append(errs, fmt.Errorf("trigger_timeout: timeout must not be negative"))
+	}
+	if plugin.TriggerRetries < 0 {
+		errs = append(errs, fmt.Errorf("trigger_retries: retries must not be negative"))
+	}
+	names := map[string]bool{plugin.MonitorAccessoryName: true}
+	for _, trigger := range plugin.Triggers {
+		if strings.TrimSpace(trigger.Name) == "" {
+			errs = append(errs, fmt.Errorf("trigger.name: name must not be empty"))
+		} else if names[trigger.Name] {
+			errs = append(errs, fmt.Errorf("trigger.name: name '%s' is not unique", trigger.Name))
+		}
+		names[trigger.Name] = true
+		if _, ok := triggerCategories[trigger.Type]; trigger.Type != "" && !ok {
+			errs = append(errs, fmt.Errorf("trigger.type: unknown type '%s' of trigger '%s'", trigger.Type, trigger.Name))
+		}
+		if trigger.Interval < 0 {
+			errs = append(errs, fmt.Errorf("trigger.interval: interval of trigger '%s' must not be negative", trigger.Name))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func (plugin *HomeKit) validateSensors() error {
+	var errs []error
+	names := map[string]bool{plugin.MonitorAccessoryName: true}
+	for _, trigger := range plugin.Triggers {
+		names[trigger.Name] = true
+	}
+	for _, sensor := range plugin.Sensors {
+		if strings.TrimSpace(sensor.Name) == "" {
+			errs = append(errs, fmt.Errorf("sensor.name: name must not be empty"))
+		} else if names[sensor.Name] {
+			errs = append(errs, fmt.Errorf("sensor.name: name '%s' is not unique", sensor.Name))
+		}
+		names[sensor.Name] = true
+		if !IsSensorType(sensor.Type) {
+			errs = append(errs, fmt.Errorf("sensor.type: unknown type '%s' of sensor '%s'", sensor.Type, sensor.Name))
+		} else if sensorFields[sensor.Type] == "" {
+			errs = append(errs, fmt.Errorf("sensor.type: type '%s' of sensor '%s' is not supported for derived sensors", sensor.Type, sensor.Name))
+		}
+		if sensor.Field != "" && !readingFields[sensor.Field] {
+			errs = append(errs, fmt.Errorf("sensor.field: unknown field '%s' of sensor '%s'", sensor.Field, sensor.Name))
+		}
+		if _, ok := sensorFunctions[sensor.Function]; sensor.Function != "" && !ok {
+			errs = append(errs, fmt.Errorf("sensor.function: unknown function '%s' of sensor '%s'", sensor.Function, sensor.Name))
+		}
+		if len(sensor.Sources) == 0 {
+			errs = append(errs, fmt.Errorf("sensor.sources: sources of sensor '%s' must not be empty", sensor.Name))
+		}
+		for _, source := range sensor.Sources {
+			if source == "" {
+				errs = append(errs, fmt.Errorf("sensor.sources: source of sensor '%s' must not be empty", sensor.Name))
+			}
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func (plugin *HomeKit) validateAccessories() error {
+	var errs []error
+	if plugin.ControllerTimeout <= 0 {
+		errs = append(errs, fmt.Errorf("controller_timeout: timeout must be positive"))
+	}
+	if plugin.DiscoveryInterval <= 0 {
+		errs = append(errs, fmt.Errorf("discovery_interval: interval must be positive"))
+	}
+	if plugin.DiscoveryRetention <= 0 {
+		errs = append(errs, fmt.Errorf("discovery_retention: retention must be positive"))
+	}
+	names := make(map[string]bool)
+	for _, accessory := range plugin.Accessories {
+		if strings.TrimSpace(accessory.Name) == "" {
+			errs = append(errs, fmt.Errorf("accessory.name: name must not be empty"))
+		} else if names[accessory.Name] {
+			errs = append(errs, fmt.Errorf("accessory.name: name '%s' is not unique", accessory.Name))
+		}
+		names[accessory.Name] = true
+		errs = append(errs, validateAddress("accessory.address", accessory.Address, true))
+		_, err := normalizePin(accessory.Pin)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("accessory.pin: %v", err))
+		}
+		for _, event := range accessory.Events {
+			if !isRemoteCharacteristic(event) {
+				errs = append(errs, fmt.Errorf("accessory.events: unknown characteristic '%s' of accessory '%s'", event, accessory.Name))
+			}
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func (plugin *HomeKit) validateValues() error {
+	var errs []error
+	// Suffixes are evaluated in this order; the first matching suffix wins
+	suffixSettings := []suffixSetting{
+		{key: "celsius_suffixes", suffixes: plugin.CelsiusSuffixes},
+		{key: "fahrenheit_suffixes", suffixes: plugin.FahrenheitSuffixes},
+		{key: "lux_suffixes", suffixes: plugin.LuxSuffixes},
+		{key: "hue_suffixes", suffixes: plugin.HueSuffixes},
+	}
+	for i, setting := range suffixSettings {
+		for _, suffix := range setting.suffixes {
+			if suffix == "" {
+				errs = append(errs, fmt.Errorf("%s: suffix must not be empty", setting.key))
+				continue
+			}
+			for _, otherSetting := range suffixSettings[i+1:] {
+				for _, otherSuffix := range otherSetting.suffixes {
+					if otherSuffix != "" && (strings.HasSuffix(suffix, otherSuffix) || strings.HasSuffix(otherSuffix, suffix)) {
+						errs = append(errs, fmt.Errorf("%s/%s: ambiguous suffixes '%s' and '%s'", setting.key, otherSetting.key, suffix, otherSuffix))
+					}
+				}
+			}
+		}
+	}
+	for _, activeValue := range plugin.ActiveValues {
+		if activeValue == "" {
+			errs = append(errs, fmt.Errorf("active_values: value must not be empty"))
+		}
+		for _, inactiveValue := range plugin.InactiveValues {
+			if activeValue == inactiveValue {
+				errs = append(errs, fmt.Errorf("active_values/inactive_values: value '%s' is both active and inactive", activeValue))
+			}
+		}
+		errs = append(errs, validateStateValue("active_values", activeValue, suffixSettings))
+	}
+	for _, inactiveValue := range plugin.InactiveValues {
+		if inactiveValue == "" {
+			errs = append(errs, fmt.Errorf("inactive_values: value must not be empty"))
+		}
+		errs = append(errs, validateStateValue("inactive_values", inactiveValue, suffixSettings))
+	}
+	return errors.Join(errs...)
+}
+
+func validateStateValue(key string, value string, suffixSettings []suffixSetting) error {
+	for _, setting := range suffixSettings {
+		for _, suffix := range setting.suffixes {
+			if suffix != "" && strings.HasSuffix(value, suffix) {
+				return fmt.Errorf("%s/%s: value '%s' is shadowed by suffix '%s'", key, setting.key, value, suffix)
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,151 @@
+// validate_test.go
+//
+// # Copyright (C) 2023-2024 Holger de Carne
+//
+// This software may be modified and distributed under the terms
+// of the MIT license.  See the LICENSE file for details.
+package homekit
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestInitDefaults(t *testing.T) {
+	plugin := NewHomeKit()
+	plugin.Log = createDummyLogger()
+	require.NoError(t, plugin.Init())
+}
+
+func TestInitDeprecatedCelsiusSuffixes(t *testing.T) {
+	plugin := NewHomeKit()
+	plugin.Log = createDummyLogger()
+	plugin.CelsiusSuffixesDeprecated = []string{" C"}
+	require.NoError(t, plugin.Init())
+	require.Equal(t, []string{" C"}, plugin.CelsiusSuffixes)
+}
+
+func TestInitDerivedHumiditySensor(t *testing.T) {
+	plugin := NewHomeKit()
+	plugin.Log = createDummyLogger()
+	plugin.Sensors = []SensorConfig{{Name: "Sensor", Type: "humidity", Field: "celsius", Sources: []string{"Hygrometer"}}}
+	err := plugin.Init()
+	require.ErrorContains(t, err, "sensor.type: type 'humidity' of sensor 'Sensor' is not supported")
+}
+
+func TestInitFailures(t *testing.T) {
+	configs := map[string]func(plugin *HomeKit){
+		"address": func(plugin *HomeKit) {
+			plugin.Address = "8001"
+		},
+		"monitor_address": func(plugin *HomeKit) {
+			plugin.MonitorAddress = ":http"
+		},
+		"monitor_path": func(plugin *HomeKit) {
+			plugin.MonitorPath = "monitor"
+		},
+		"status_path": func(plugin *HomeKit) {
+			plugin.StatusPath = plugin.MonitorPath
+		},
+		"metrics_path": func(plugin *HomeKit) {
+			plugin.MetricsPath = plugin.MonitorPath
+		},
+		"metrics_expiry": func(plugin *HomeKit) {
+			plugin.MetricsExpiry = -1
+		},
+		"hap_store_type": func(plugin *HomeKit) {
+			plugin.HAPStoreType = "unknown"
+		},
+		"hap_store_path": func(plugin *HomeKit) {
+			plugin.HAPStorePath = "homekit_test.go"
+		},
+		"hap_store_encryption": func(plugin *HomeKit) {
+			plugin.HAPStoreEncryption = "unknown"
+		},
+		"hap_store_key_env": func(plugin *HomeKit) {
+			plugin.HAPStoreEncryption = "env"
+			plugin.HAPStoreKeyEnv = ""
+		},
+		"hap_store_key_file": func(plugin *HomeKit) {
+			plugin.HAPStoreEncryption = "file"
+		},
+		"hap_store_key": func(plugin *HomeKit) {
+			plugin.HAPStoreEncryption = "secret"
+		},
+		"record_path": func(plugin *HomeKit) {
+			plugin.RecordPath = "nonexistent/monitor.jsonl"
+		},
+		"monitor_rate_limit": func(plugin *HomeKit) {
+			plugin.MonitorRateLimit = -1
+		},
+		"monitor_accessory_name": func(plugin *HomeKit) {
+			plugin.MonitorAccessoryName = " "
+		},
+		"trigger_type": func(plugin *HomeKit) {
+			plugin.TriggerType = "button"
+		},
+		"trigger.type": func(plugin *HomeKit) {
+			plugin.Triggers = []TriggerConfig{{Name: "Trigger", Type: "button"}}
+		},
+		"trigger_pulse": func(plugin *HomeKit) {
+			plugin.TriggerPulse = 0
+		},
+		"trigger_retries": func(plugin *HomeKit) {
+			plugin.TriggerRetries = -1
+		},
+		"sensor.name": func(plugin *HomeKit) {
+			plugin.Sensors = []SensorConfig{{Name: plugin.MonitorAccessoryName, Type: "temperature", Sources: []string{"Thermometer"}}}
+		},
+		"sensor.type": func(plugin *HomeKit) {
+			plugin.Sensors = []SensorConfig{{Name: "Sensor", Type: "pressure", Sources: []string{"Thermometer"}}}
+		},
+		"sensor.field": func(plugin *HomeKit) {
+			plugin.Sensors = []SensorConfig{{Name: "Sensor", Type: "temperature", Field: "percent", Sources: []string{"Thermometer"}}}
+		},
+		"sensor.function": func(plugin *HomeKit) {
+			plugin.Sensors = []SensorConfig{{Name: "Sensor", Type: "temperature", Function: "median", Sources: []string{"Thermometer"}}}
+		},
+		"sensor.sources": func(plugin *HomeKit) {
+			plugin.Sensors = []SensorConfig{{Name: "Sensor", Type: "temperature"}}
+		},
+		"accessory.pin": func(plugin *HomeKit) {
+			plugin.Accessories = []AccessoryConfig{{Name: "Accessory", Pin: "1234"}}
+		},
+		"accessory.events": func(plugin *HomeKit) {
+			plugin.Accessories = []AccessoryConfig{{Name: "Accessory", Pin: "03145154", Events: []string{"Humidity"}}}
+		},
+		"accessory.address": func(plugin *HomeKit) {
+			plugin.Accessories = []AccessoryConfig{{Name: "Accessory", Address: "localhost", Pin: "03145154"}}
+		},
+		"discovery_interval": func(plugin *HomeKit) {
+			plugin.DiscoveryInterval = 0
+		},
+		"discovery_retention": func(plugin *HomeKit) {
+			plugin.DiscoveryRetention = 0
+		},
+		"monitor_accessory_pin": func(plugin *HomeKit) {
+			plugin.MonitorAccessoryPin = "12345678"
+		},
+		"fahrenheit_suffixes": func(plugin *HomeKit) {
+			plugin.FahrenheitSuffixes = []string{""}
+		},
+		"lux_suffixes": func(plugin *HomeKit) {
+			plugin.LuxSuffixes = []string{"°"}
+		},
+		"inactive_values": func(plugin *HomeKit) {
+			plugin.InactiveValues = append(plugin.InactiveValues, plugin.ActiveValues[0])
+		},
+		"active_values": func(plugin *HomeKit) {
+			plugin.ActiveValues = append(plugin.ActiveValues, "On °C")
+		},
+	}
+	for key, config := range configs {
+		plugin := NewHomeKit()
+		plugin.Log = createDummyLogger()
+		config(plugin)
+		err := plugin.Init()
+		require.Error(t, err, key)
+		require.Contains(t, err.Error(), key)
+	}
+}
@@ -0,0 +1,260 @@
+// homekit.go
+//
+// Copyright (C) 2023-2024 Holger de Carne
+//
+// This software may be modified and distributed under the terms
+// of the MIT license.  See the LICENSE file for details.
+
+package homekit
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+
+	dnssdlog "github.com/brutella/dnssd/log"
+	"github.com/brutella/hap"
+	"github.com/brutella/hap/accessory"
+	haplog "github.com/brutella/hap/log"
+	input "github.com/hdecarne-github/homekit-telegraf-plugin/plugins/inputs/homekit"
+	"github.com/influxdata/telegraf"
+	"github.com/influxdata/telegraf/plugins/outputs"
+)
+
+// SensorConfig defines a virtual sensor accessory and the metric field it reports.
+type SensorConfig struct {
+	Name        string            `toml:"name"`
+	Type        string            `toml:"type"`
+	Measurement string            `toml:"measurement"`
+	Field       string            `toml:"field"`
+	Tags        map[string]string `toml:"tags"`
+}
+
+type HomeKit struct {
+	Address      string         `toml:"address"`
+	HAPStoreType string         `toml:"hap_store_type"`
+	HAPStorePath string         `toml:"hap_store_path"`
+	BridgeName   string         `toml:"bridge_name"`
+	BridgePin    string         `toml:"bridge_pin"`
+	Sensors      []SensorConfig `toml:"sensor"`
+	Debug        bool           `toml:"debug"`
+	HAPDebug     bool           `toml:"hap_debug"`
+	DNSSDDebug   bool           `toml:"dnssd_debug"`
+
+	Log telegraf.Logger
+
+	sensors       []*sensor
+	store         hap.Store
+	stopServer    context.CancelFunc
+	serverStopped sync.WaitGroup
+}
+
+type sensor struct {
+	config SensorConfig
+	*input.Sensor
+}
+
+func NewHomeKit() *HomeKit {
+	return &HomeKit{
+		Address:      ":8002",
+		HAPStoreType: "fs",
+		HAPStorePath: ".hap-output",
+		BridgeName:   "Telegraf",
+		BridgePin:    "00102003",
+		Sensors:      make([]SensorConfig, 0)}
+}
+
+func (plugin *HomeKit) SampleConfig() string {
+	return `
+  ## The address (host:port) to run the HAP server on
+  # address = ":8002"
+  ## The type of the HAP store (fs = directory with one file per entry, json, bbolt or sqlite = single file)
+  # hap_store_type = "fs"
+  ## The path to store the HAP state (must differ from the input plugin's state directory)
+  # hap_store_path = ".hap-output"
+  ## The name of the bridge accessory containing the sensor accessories
+  # bridge_name = "Telegraf"
+  ## The pin to use for pairing the bridge accessory ("random" generates and stores a random pin)
+  # bridge_pin = "00102003"
+  ## Enable debug output
+  # debug = false
+  ## Enable debug output of the HAP library
+  # hap_debug = false
+  ## Enable debug output of the DNS-SD library
+  # dnssd_debug = false
+  ## The sensor accessories to publish. Each sensor reports the given field of the metrics matching the given
+  ## measurement and tags. Supported sensor types are temperature (°C), humidity (%), light (lx) and contact
+  ## (0 = contact detected, anything else = contact not detected).
+  # [[outputs.homekit.sensor]]
+  #   name = "CPU Temperature"
+  #   type = "temperature"
+  #   measurement = "temp"
+  #   field = "temp"
+  #   [outputs.homekit.sensor.tags]
+  #     sensor = "coretemp_package_id_0"
+`
+}
+
+func (plugin *HomeKit) Description() string {
+	return "Publish metrics as HomeKit sensors"
+}
+
+func (plugin *HomeKit) Init() error {
+	var errs []error
+	_, _, err := net.SplitHostPort(plugin.Address)
+	if err != nil {
+		errs = append(errs, fmt.Errorf("address: invalid address '%s' (cause: %v)", plugin.Address, err))
+	}
+	if !input.IsStoreType(plugin.HAPStoreType) {
+		errs = append(errs, fmt.Errorf("hap_store_type: unknown store type '%s'", plugin.HAPStoreType))
+	}
+	if plugin.HAPStorePath == "" {
+		errs = append(errs, fmt.Errorf("hap_store_path: path must not be empty"))
+	}
+	if strings.TrimSpace(plugin.BridgeName) == "" {
+		errs = append(errs, fmt.Errorf("bridge_name: name must not be empty"))
+	}
+	names := map[string]bool{plugin.BridgeName: true}
+	for _, sensorConfig := range plugin.Sensors {
+		if strings.TrimSpace(sensorConfig.Name) == "" {
+			errs = append(errs, fmt.Errorf("sensor.name: name must not be empty"))
+		} else if names[sensorConfig.Name] {
+			errs = append(errs, fmt.Errorf("sensor.name: name '%s' is not unique", sensorConfig.Name))
+		}
+		names[sensorConfig.Name] = true
+		if !input.IsSensorType(sensorConfig.Type) {
+			errs = append(errs, fmt.Errorf("sensor.type: unknown type '%s' of sensor '%s'", sensorConfig.Type, sensorConfig.Name))
+		}
+		if sensorConfig.Measurement == "" || sensorConfig.Field == "" {
+			errs = append(errs, fmt.Errorf("sensor.measurement/sensor.field: measurement and field of sensor '%s' must not be empty", sensorConfig.Name))
+		}
+	}
+	err = errors.Join(errs...)
+	if err != nil {
+		return fmt.Errorf("invalid configuration:\n%w", err)
+	}
+	return nil
+}
+
+func (plugin *HomeKit) Connect() error {
+	if !plugin.Debug {
+		haplog.Info.Disable()
+		dnssdlog.Info.Disable()
+	}
+	if plugin.HAPDebug {
+		haplog.Debug.Enable()
+	}
+	if plugin.DNSSDDebug {
+		dnssdlog.Debug.Enable()
+	}
+	plugin.Log.Infof("Setting up sensor bridge: %s", plugin.BridgeName)
+	bridge := accessory.NewBridge(input.AccessoryInfo(plugin.BridgeName))
+	plugin.sensors = make([]*sensor, 0, len(plugin.Sensors))
+	sensorAccessories := make([]*accessory.A, 0, len(plugin.Sensors))
+	for _, sensorConfig := range plugin.Sensors {
+		plugin.Log.Infof("Setting up sensor accessory: %s (type: %s, field: %s.%s)", sensorConfig.Name, sensorConfig.Type, sensorConfig.Measurement, sensorConfig.Field)
+		virtualSensor, err := input.NewSensor(sensorConfig.Name, sensorConfig.Type)
+		if err != nil {
+			return err
+		}
+		plugin.sensors = append(plugin.sensors, &sensor{config: sensorConfig, Sensor: virtualSensor})
+		sensorAccessories = append(sensorAccessories, virtualSensor.Accessory)
+	}
+	plugin.Log.Infof("Starting HAP server: %s", plugin.Address)
+	store, err := input.OpenHAPStore(plugin.HAPStoreType, plugin.HAPStorePath)
+	if err != nil {
+		plugin.Log.Errorf("Failed to open HAP store (%v)", err)
+		return err
+	}
+	server, uri, err := input.NewHAPServer(store, plugin.Address, plugin.BridgePin, bridge.A, sensorAccessories...)
+	if err != nil {
+		plugin.Log.Errorf("Failed to start HAP server (%v)", err)
+		input.CloseHAPStore(store)
+		return err
+	}
+	plugin.store = store
+	plugin.Log.Infof("Sensor bridge pin: %s (setup URI: %s)", server.Pin, uri)
+	serverCtx, stopServer := context.WithCancel(context.Background())
+	plugin.stopServer = stopServer
+	plugin.serverStopped.Add(1)
+	go func() {
+		defer plugin.serverStopped.Done()
+		_ = server.ListenAndServe(serverCtx)
+	}()
+	return nil
+}
+
+func (plugin *HomeKit) Close() error {
+	plugin.Log.Infof("Stopping HAP server: %s", plugin.Address)
+	if plugin.stopServer != nil {
+		plugin.stopServer()
+	}
+	plugin.serverStopped.Wait()
+	if plugin.store != nil {
+		return input.CloseHAPStore(plugin.store)
+	}
+	return nil
+}
+
+func (plugin *HomeKit) Write(metrics []telegraf.Metric) error {
+	for _, metric := range metrics {
+		for _, mappedSensor := range plugin.sensors {
+			if !mappedSensor.matches(metric) {
+				continue
+			}
+			fieldValue, ok := metric.GetField(mappedSensor.config.Field)
+			if !ok {
+				continue
+			}
+			value, ok := sensorValue(fieldValue)
+			if !ok {
+				plugin.Log.Warnf("Unsupported value type %T of field %s.%s for sensor %s", fieldValue, metric.Name(), mappedSensor.config.Field, mappedSensor.Name)
+				continue
+			}
+			if plugin.Debug {
+				plugin.Log.Infof("Updating sensor %s: %v", mappedSensor.Name, value)
+			}
+			mappedSensor.Update(value)
+		}
+	}
+	return nil
+}
+
+func (mappedSensor *sensor) matches(metric telegraf.Metric) bool {
+	if metric.Name() != mappedSensor.config.Measurement {
+		return false
+	}
+	for key, value := range mappedSensor.config.Tags {
+		tagValue, ok := metric.GetTag(key)
+		if !ok || tagValue != value {
+			return false
+		}
+	}
+	return true
+}
+
+func sensorValue(fieldValue interface{}) (float64, bool) {
+	switch value := fieldValue.(type) {
+	case float64:
+		return value, true
+	case int64:
+		return float64(value), true
+	case uint64:
+		return float64(value), true
+	case bool:
+		if value {
+			return 1, true
+		}
+		return 0, true
+	}
+	return 0, false
+}
+
+func init() {
+	outputs.Add("homekit", func() telegraf.Output {
+		return NewHomeKit()
+	})
+}
@@ -0,0 +1,132 @@
+// homekit_test.go
+//
+// # Copyright (C) 2023-2024 Holger de Carne
+//
+// This software may be modified and distributed under the terms
+// of the MIT license.  See the LICENSE file for details.
+package homekit
+
+import (
+	"net"
+	"path/filepath"
+	"testing"
+	"time"
+
+	input "github.com/hdecarne-github/homekit-telegraf-plugin/plugins/inputs/homekit"
+	"github.com/influxdata/telegraf"
+	"github.com/influxdata/telegraf/testutil"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSampleConfig(t *testing.T) {
+	plugin := NewHomeKit()
+	require.NotEmpty(t, plugin.SampleConfig())
+	require.NotEmpty(t, plugin.Description())
+}
+
+func TestInitDefaults(t *testing.T) {
+	plugin := NewHomeKit()
+	plugin.Log = testutil.Logger{}
+	require.NoError(t, plugin.Init())
+}
+
+func TestInitFailures(t *testing.T) {
+	configs := map[string]func(plugin *HomeKit){
+		"address": func(plugin *HomeKit) {
+			plugin.Address = "8002"
+		},
+		"hap_store_path": func(plugin *HomeKit) {
+			plugin.HAPStorePath = ""
+		},
+		"bridge_name": func(plugin *HomeKit) {
+			plugin.BridgeName = " "
+		},
+		"sensor.name": func(plugin *HomeKit) {
+			plugin.Sensors = []SensorConfig{{Name: plugin.BridgeName, Type: "temperature", Measurement: "temp", Field: "temp"}}
+		},
+		"sensor.type": func(plugin *HomeKit) {
+			plugin.Sensors = []SensorConfig{{Name: "Sensor", Type: "pressure", Measurement: "temp", Field: "temp"}}
+		},
+		"sensor.field": func(plugin *HomeKit) {
+			plugin.Sensors = []SensorConfig{{Name: "Sensor", Type: "temperature", Measurement: "temp"}}
+		},
+	}
+	for key, config := range configs {
+		plugin := NewHomeKit()
+		plugin.Log = testutil.Logger{}
+		config(plugin)
+		err := plugin.Init()
+		require.Error(t, err, key)
+		require.Contains(t, err.Error(), key)
+	}
+}
+
+func TestConnectInvalidPinClosesStore(t *testing.T) {
+	storePath := filepath.Join(t.TempDir(), "hap.db")
+	plugin := NewHomeKit()
+	plugin.Address = freeAddress(t)
+	plugin.HAPStoreType = "bbolt"
+	plugin.HAPStorePath = storePath
+	plugin.BridgePin = "12345678"
+	plugin.Log = testutil.Logger{}
+
+	require.Error(t, plugin.Connect())
+	store, err := input.OpenHAPStore("bbolt", storePath)
+	require.NoError(t, err)
+	require.NoError(t, input.CloseHAPStore(store))
+}
+
+func TestWrite(t *testing.T) {
+	plugin := NewHomeKit()
+	plugin.Address = freeAddress(t)
+	plugin.HAPStorePath = filepath.Join(t.TempDir(), ".hap-output")
+	plugin.Sensors = []SensorConfig{
+		{Name: "CPU Temperature", Type: "temperature", Measurement: "temp", Field: "temp", Tags: map[string]string{"sensor": "cpu"}},
+		{Name: "Outdoor Humidity", Type: "humidity", Measurement: "weather", Field: "humidity"},
+		{Name: "Outdoor Light", Type: "light", Measurement: "weather", Field: "lux"},
+		{Name: "Server Door", Type: "contact", Measurement: "door", Field: "open"},
+	}
+	plugin.Log = testutil.Logger{}
+	require.NoError(t, plugin.Init())
+
+	defer plugin.Close()
+	require.NoError(t, plugin.Connect())
+	waitForAddress(t, plugin.Address)
+
+	now := time.Now()
+	require.NoError(t, plugin.Write([]telegraf.Metric{
+		testutil.MustMetric("temp", map[string]string{"sensor": "cpu"}, map[string]interface{}{"temp": 55.5}, now),
+		testutil.MustMetric("temp", map[string]string{"sensor": "gpu"}, map[string]interface{}{"temp": 75.0}, now),
+		testutil.MustMetric("weather", map[string]string{}, map[string]interface{}{"humidity": int64(64), "lux": uint64(1200)}, now),
+		testutil.MustMetric("door", map[string]string{}, map[string]interface{}{"open": true}, now),
+		testutil.MustMetric("door", map[string]string{}, map[string]interface{}{"open": "unknown"}, now),
+	}))
+	require.Len(t, plugin.sensors, 4)
+	require.EqualValues(t, 55.5, sensorState(plugin.sensors[0]))
+	require.EqualValues(t, 64, sensorState(plugin.sensors[1]))
+	require.EqualValues(t, 1200, sensorState(plugin.sensors[2]))
+	require.EqualValues(t, 1, sensorState(plugin.sensors[3]))
+}
+
+func sensorState(mappedSensor *sensor) interface{} {
+	return mappedSensor.Accessory.Ss[1].Cs[0].Val
+}
+
+func freeAddress(t *testing.T) string {
+	listener, err := net.Listen("tcp", "localhost:0")
+	require.NoError(t, err)
+	address := listener.Addr().String()
+	require.NoError(t, listener.Close())
+	return address
+}
+
+func waitForAddress(t *testing.T, address string) {
+	require.Eventually(t, func() bool {
+		conn, err := net.Dial("tcp", address)
+		if err != nil {
+			return false
+		}
+		conn.Close()
+		return true
+	}, time.Second, 10*time.Millisecond)
+}